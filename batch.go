@@ -0,0 +1,54 @@
+package render
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+// Batch is a Renderer for bulk API responses, reporting the outcome of each
+// item of a bulk request individually.
+type Batch struct {
+	XMLName xml.Name    `json:"-" xml:"batch"`
+	Items   []BatchItem `json:"items" xml:"item"`
+}
+
+// BatchItem is the outcome of a single item of a Batch.
+type BatchItem struct {
+	Index  int         `json:"index" xml:"index"`
+	Status int         `json:"status" xml:"status"`
+	Body   interface{} `json:"body,omitempty" xml:"body,omitempty"`
+	Error  string      `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// NewBatch returns an empty Batch.
+func NewBatch() *Batch {
+	return &Batch{Items: []BatchItem{}}
+}
+
+// Add records the outcome of the item at index of the bulk request.
+func (b *Batch) Add(index int, status int, body interface{}) {
+	b.Items = append(b.Items, BatchItem{Index: index, Status: status, Body: body})
+}
+
+// AddError records the failure of the item at index of the bulk request.
+func (b *Batch) AddError(index int, status int, err error) {
+	item := BatchItem{Index: index, Status: status}
+	if err != nil {
+		item.Error = err.Error()
+	}
+	b.Items = append(b.Items, item)
+}
+
+// Render sets the response status code hint to 207 Multi-Status if any of
+// the items didn't succeed, or 200 OK otherwise.
+func (b *Batch) Render(w http.ResponseWriter, r *http.Request) error {
+	status := http.StatusOK
+	for _, item := range b.Items {
+		if item.Status < 200 || item.Status > 299 {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	Status(r, status)
+	return nil
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		fill       func(b *Batch)
+		wantStatus int
+		wantBody   string
+	}{
+		{"all success", func(b *Batch) {
+			b.Add(0, http.StatusCreated, M{"id": 1})
+			b.Add(1, http.StatusOK, nil)
+		}, http.StatusOK, `{"items":[{"index":0,"status":201,"body":{"id":1}},{"index":1,"status":200}]}`},
+		{"mixed", func(b *Batch) {
+			b.Add(0, http.StatusCreated, M{"id": 1})
+			b.AddError(1, http.StatusConflict, errors.New("duplicate"))
+		}, http.StatusMultiStatus, `{"items":[{"index":0,"status":201,"body":{"id":1}},{"index":1,"status":409,"error":"duplicate"}]}`},
+		{"all failure", func(b *Batch) {
+			b.AddError(0, http.StatusBadRequest, errors.New("invalid"))
+			b.AddError(1, http.StatusInternalServerError, nil)
+		}, http.StatusMultiStatus, `{"items":[{"index":0,"status":400,"error":"invalid"},{"index":1,"status":500}]}`},
+		{"empty", func(b *Batch) {}, http.StatusOK, `{"items":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBatch()
+			tt.fill(b)
+			w := httptest.NewRecorder()
+			if err := Render(w, httptest.NewRequest("POST", "/", nil), b); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Body.String(); got != tt.wantBody+"\n" {
+				t.Errorf("got %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CacheControl is a middleware that sets the Cache-Control header of
+// responses to the given directives, e.g. "public", "max-age=3600". A
+// Cache-Control header set by the handler itself is left untouched.
+func CacheControl(directives ...string) func(next http.Handler) http.Handler {
+	value := strings.Join(directives, ", ")
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww := &hookWriter{ResponseWriter: w, beforeHeader: func(w http.ResponseWriter, status int) {
+				if w.Header().Get("Cache-Control") == "" {
+					w.Header().Set("Cache-Control", value)
+				}
+			}}
+			next.ServeHTTP(ww, r)
+			ww.flushHook(http.StatusOK)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// CacheControlNoStore is a CacheControl middleware preventing responses from
+// being stored by any cache.
+func CacheControlNoStore() func(next http.Handler) http.Handler {
+	return CacheControl("no-store")
+}
+
+// CacheControlPublic is a CacheControl middleware allowing responses to be
+// cached by any cache for maxAge.
+func CacheControlPublic(maxAge time.Duration) func(next http.Handler) http.Handler {
+	return CacheControl("public", maxAgeDirective(maxAge))
+}
+
+// CacheControlPrivate is a CacheControl middleware allowing responses to be
+// cached by the client only, for maxAge.
+func CacheControlPrivate(maxAge time.Duration) func(next http.Handler) http.Handler {
+	return CacheControl("private", maxAgeDirective(maxAge))
+}
+
+// CacheControlImmutable is a CacheControl middleware for responses that never
+// change, e.g. fingerprinted assets, which are cached for a year.
+func CacheControlImmutable() func(next http.Handler) http.Handler {
+	return CacheControl("public", maxAgeDirective(365*24*time.Hour), "immutable")
+}
+
+func maxAgeDirective(maxAge time.Duration) string {
+	return fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+}
+
+// NoCache is a middleware for sensitive routes, e.g. authentication, that
+// prevents responses from being cached by clients and proxies, including
+// HTTP/1.0 ones.
+func NoCache(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+		w.Header().Set("Pragma", "no-cache")
+		w.Header().Set("Expires", "0")
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
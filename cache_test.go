@@ -0,0 +1,74 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		want       string
+	}{
+		{"directives", CacheControl("public", "max-age=60"), "public, max-age=60"},
+		{"no-store", CacheControlNoStore(), "no-store"},
+		{"public", CacheControlPublic(time.Hour), "public, max-age=3600"},
+		{"private", CacheControlPrivate(90 * time.Second), "private, max-age=90"},
+		{"immutable", CacheControlImmutable(), "public, max-age=31536000, immutable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h := tt.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				JSON(w, r, M{"ok": true})
+			}))
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControlHandlerHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	h := CacheControlPublic(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		NoContent(w, r)
+	}))
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("got %q, want the handler's no-cache", got)
+	}
+}
+
+func TestCacheControlEmptyResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	h := CacheControlNoStore()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got %q, want no-store", got)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	w := httptest.NewRecorder()
+	NoCache(http.HandlerFunc(okHandler)).ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+
+	want := map[string]string{
+		"Cache-Control": "no-store, no-cache, must-revalidate",
+		"Pragma":        "no-cache",
+		"Expires":       "0",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s: got %q, want %q", k, got, v)
+		}
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("got %d %q, want the handler response", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,90 @@
+package render
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charset is the character set of text-based responses, e.g. JSON, XML, HTML
+// and plain text. It's added as the charset parameter of their Content-Type,
+// unless empty, and responses are transcoded from UTF-8 as needed.
+//
+// Besides "utf-8", the "utf-16", "utf-16be", "utf-16le" and "iso-8859-1"
+// charsets are supported out of the box; use RegisterCharset for others, e.g.
+// backed by golang.org/x/text/encoding.
+var Charset = "utf-8"
+
+var (
+	charsetsMu sync.RWMutex
+	charsets   = map[string]func(b []byte) []byte{
+		"utf-16":     encodeUTF16BOM,
+		"utf-16be":   encodeUTF16BE,
+		"utf-16le":   encodeUTF16LE,
+		"iso-8859-1": encodeLatin1,
+	}
+)
+
+// RegisterCharset registers a function transcoding UTF-8 text into the named
+// charset, for use with Charset.
+func RegisterCharset(name string, fn func(utf8 []byte) []byte) {
+	charsetsMu.Lock()
+	defer charsetsMu.Unlock()
+	charsets[strings.ToLower(name)] = fn
+}
+
+// contentType returns mediaType with the Charset parameter.
+func contentType(mediaType string) string {
+	if Charset == "" {
+		return mediaType
+	}
+	return mediaType + "; charset=" + Charset
+}
+
+// encodeCharset transcodes UTF-8 text into Charset. Text is left as is for
+// unknown charsets.
+func encodeCharset(b []byte) []byte {
+	charsetsMu.RLock()
+	fn, ok := charsets[strings.ToLower(Charset)]
+	charsetsMu.RUnlock()
+	if !ok {
+		return b
+	}
+	return fn(b)
+}
+
+func encodeUTF16BOM(b []byte) []byte {
+	return append([]byte{0xfe, 0xff}, encodeUTF16BE(b)...)
+}
+
+func encodeUTF16BE(b []byte) []byte {
+	return encodeUTF16(b, binary.BigEndian)
+}
+
+func encodeUTF16LE(b []byte) []byte {
+	return encodeUTF16(b, binary.LittleEndian)
+}
+
+func encodeUTF16(b []byte, order binary.ByteOrder) []byte {
+	u := utf16.Encode([]rune(string(b)))
+	out := make([]byte, 2*len(u))
+	for i, c := range u {
+		order.PutUint16(out[2*i:], c)
+	}
+	return out
+}
+
+// encodeLatin1 transcodes to ISO-8859-1, replacing characters it can't
+// represent with '?'.
+func encodeLatin1(b []byte) []byte {
+	out := make([]byte, 0, utf8.RuneCount(b))
+	for _, c := range string(b) {
+		if c > 0xff {
+			c = '?'
+		}
+		out = append(out, byte(c))
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package render
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCharset(t *testing.T) {
+	defer func(charset string) { Charset = charset }(Charset)
+
+	tests := []struct {
+		charset  string
+		wantType string
+		wantBody []byte
+	}{
+		{"utf-8", "application/json; charset=utf-8", []byte(`{"name":"é"}`)},
+		{"", "application/json", []byte(`{"name":"é"}`)},
+		{"utf-16be", "application/json; charset=utf-16be", []byte{0, '{', 0, '"', 0, 'n', 0, 'a', 0, 'm', 0, 'e', 0, '"', 0, ':', 0, '"', 0, 0xe9, 0, '"', 0, '}'}},
+		{"utf-16le", "application/json; charset=utf-16le", []byte{'{', 0, '"', 0, 'n', 0, 'a', 0, 'm', 0, 'e', 0, '"', 0, ':', 0, '"', 0, 0xe9, 0, '"', 0, '}', 0}},
+		{"iso-8859-1", "application/json; charset=iso-8859-1", []byte{'{', '"', 'n', 'a', 'm', 'e', '"', ':', '"', 0xe9, '"', '}'}},
+		{"koi8-r", "application/json; charset=koi8-r", []byte(`{"name":"é"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.charset, func(t *testing.T) {
+			Charset = tt.charset
+			w := httptest.NewRecorder()
+			JSON(w, httptest.NewRequest("GET", "/", nil), M{"name": "é"})
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", ct, tt.wantType)
+			}
+			// Strip the newline added by the JSON encoder, in any charset.
+			body := bytes.TrimRight(w.Body.Bytes(), "\x00\n")
+			want := bytes.TrimRight(tt.wantBody, "\x00")
+			if !bytes.Equal(body, want) {
+				t.Errorf("got % x, want % x", body, want)
+			}
+		})
+	}
+}
+
+func TestCharsetUTF16BOM(t *testing.T) {
+	defer func(charset string) { Charset = charset }(Charset)
+	Charset = "utf-16"
+
+	w := httptest.NewRecorder()
+	PlainText(w, httptest.NewRequest("GET", "/", nil), "a€")
+	if want := []byte{0xfe, 0xff, 0, 'a', 0x20, 0xac}; !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("got % x, want % x", w.Body.Bytes(), want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-16" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
+
+func TestCharsetLatin1Replacement(t *testing.T) {
+	if got := string(encodeLatin1([]byte("a€é"))); got != "a?\xe9" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRegisterCharset(t *testing.T) {
+	defer func(charset string) { Charset = charset }(Charset)
+	defer func() {
+		charsetsMu.Lock()
+		delete(charsets, "x-upper")
+		charsetsMu.Unlock()
+	}()
+	RegisterCharset("X-Upper", func(b []byte) []byte { return bytes.ToUpper(b) })
+	Charset = "x-upper"
+
+	w := httptest.NewRecorder()
+	HTML(w, httptest.NewRequest("GET", "/", nil), "<p>gopher</p>")
+	if got := w.Body.String(); got != "<P>GOPHER</P>" {
+		t.Errorf("got %q", got)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasSuffix(ct, "; charset=x-upper") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
@@ -0,0 +1,34 @@
+package render
+
+import "sync"
+
+// Codec bundles the Encoder and Decoder of a ContentType, see RegisterCodec.
+type Codec struct {
+	Encoder     Encoder
+	Decoder     Decoder
+	ContentType ContentType
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[ContentType]Codec{}
+)
+
+// RegisterCodec registers both the Encoder and the Decoder of c at once, for
+// DefaultResponder and DefaultDecoder to use for its ContentType instead of
+// the built-in ones, e.g. a faster JSON implementation. A nil Encoder or
+// Decoder leaves the built-in one in place. Content types unknown to this
+// package are only selected when forced, e.g. with WithContentType.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.ContentType] = c
+}
+
+// LookupCodec returns the Codec registered for ct, if any.
+func LookupCodec(ct ContentType) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[ct]
+	return c, ok
+}
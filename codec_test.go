@@ -0,0 +1,72 @@
+package render
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func unregisterCodec(ct ContentType) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	delete(codecs, ct)
+}
+
+// upperCodec encodes and decodes namedPayloads as their upper-cased name.
+var upperCodec = Codec{
+	ContentType: ContentTypeXML,
+	Encoder: func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(strings.ToUpper(v.(*namedPayload).Name))) //nolint:errcheck
+	},
+	Decoder: func(r io.Reader, v interface{}) error {
+		b, err := io.ReadAll(r)
+		v.(*namedPayload).Name = strings.ToLower(string(b))
+		return err
+	},
+}
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec(upperCodec)
+	defer unregisterCodec(ContentTypeXML)
+
+	if c, ok := LookupCodec(ContentTypeXML); !ok || c.ContentType != ContentTypeXML || c.Encoder == nil {
+		t.Errorf("got %+v, %v, want the registered codec", c, ok)
+	}
+	if _, ok := LookupCodec(ContentTypeJSON); ok {
+		t.Error("got a codec for an unregistered content type")
+	}
+
+	w := httptest.NewRecorder()
+	Respond(w, acceptRequest("application/xml"), &namedPayload{Name: "gopher"})
+	if w.Body.String() != "GOPHER" {
+		t.Errorf("got %q, want the codec's encoding", w.Body.String())
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("GOPHER"))
+	r.Header.Set("Content-Type", "application/xml")
+	var p namedPayload
+	if err := Bind(r, &p); err != nil || p.Name != "gopher" {
+		t.Errorf("got %+v, %v, want the codec's decoding", p, err)
+	}
+
+	// Other content types are left alone.
+	w = httptest.NewRecorder()
+	Respond(w, acceptRequest("application/json"), &namedPayload{Name: "gopher"})
+	if got := strings.TrimSpace(w.Body.String()); got != `{"name":"gopher"}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestRegisterCodecPartial(t *testing.T) {
+	RegisterCodec(Codec{ContentType: ContentTypeXML, Decoder: upperCodec.Decoder})
+	defer unregisterCodec(ContentTypeXML)
+
+	w := httptest.NewRecorder()
+	Respond(w, acceptRequest("application/xml"), &namedPayload{Name: "gopher"})
+	if !strings.Contains(w.Body.String(), "<name>gopher</name>") {
+		t.Errorf("got %q, want the built-in encoder", w.Body.String())
+	}
+}
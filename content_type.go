@@ -2,8 +2,13 @@ package render
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"mime"
 	"net/http"
+	"runtime"
 	"strings"
+	"sync"
 )
 
 var (
@@ -22,8 +27,62 @@ const (
 	ContentTypeXML
 	ContentTypeForm
 	ContentTypeEventStream
+	ContentTypeJSONC
+	ContentTypeGRPCWebJSON
+	ContentTypeGRPCWebProto
 )
 
+// String returns the canonical media type of the ContentType, or an empty
+// string for ContentTypeUnknown.
+func (c ContentType) String() string {
+	switch c {
+	case ContentTypePlainText:
+		return "text/plain"
+	case ContentTypeHTML:
+		return "text/html"
+	case ContentTypeJSON:
+		return "application/json"
+	case ContentTypeXML:
+		return "application/xml"
+	case ContentTypeForm:
+		return "application/x-www-form-urlencoded"
+	case ContentTypeEventStream:
+		return "text/event-stream"
+	case ContentTypeJSONC:
+		return "application/x-jsonc"
+	case ContentTypeGRPCWebJSON:
+		return "application/grpc-web+json"
+	case ContentTypeGRPCWebProto:
+		return "application/grpc-web+proto"
+	default:
+		return ""
+	}
+}
+
+// MarshalText encodes the ContentType as its canonical media type, so that it
+// can be used in JSON, YAML or TOML configuration files.
+func (c ContentType) MarshalText() ([]byte, error) {
+	if c == ContentTypeUnknown {
+		return nil, fmt.Errorf("render: cannot marshal unknown content type")
+	}
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText parses a media type, such as "application/json", into a
+// ContentType. Media type parameters are ignored.
+func (c *ContentType) UnmarshalText(text []byte) error {
+	mediaType, _, err := mime.ParseMediaType(string(text))
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	contentType := GetContentType(mediaType)
+	if contentType == ContentTypeUnknown {
+		return fmt.Errorf("render: unknown content type %q", text)
+	}
+	*c = contentType
+	return nil
+}
+
 func GetContentType(s string) ContentType {
 	s = strings.TrimSpace(strings.Split(s, ";")[0])
 	switch s {
@@ -31,14 +90,20 @@ func GetContentType(s string) ContentType {
 		return ContentTypePlainText
 	case "text/html", "application/xhtml+xml":
 		return ContentTypeHTML
-	case "application/json", "text/javascript":
+	case "application/json", "text/javascript", "application/problem+json":
 		return ContentTypeJSON
-	case "text/xml", "application/xml":
+	case "text/xml", "application/xml", "application/problem+xml":
 		return ContentTypeXML
 	case "application/x-www-form-urlencoded":
 		return ContentTypeForm
 	case "text/event-stream":
 		return ContentTypeEventStream
+	case "application/x-jsonc":
+		return ContentTypeJSONC
+	case "application/grpc-web+json":
+		return ContentTypeGRPCWebJSON
+	case "application/grpc-web", "application/grpc-web+proto":
+		return ContentTypeGRPCWebProto
 	default:
 		return ContentTypeUnknown
 	}
@@ -48,23 +113,93 @@ func GetContentType(s string) ContentType {
 func SetContentType(contentType ContentType) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			r = r.WithContext(context.WithValue(r.Context(), ContentTypeCtxKey, contentType))
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, WithContentType(r, contentType))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
-// GetRequestContentType is a helper function that returns ContentType based on
+// WithContentType returns a shallow copy of r with its response content type
+// forced to contentType, like SetContentType does for a whole handler chain,
+// e.g. for a download handler responding the same regardless of Accept.
+func WithContentType(r *http.Request, contentType ContentType) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ContentTypeCtxKey, contentType))
+}
+
+// AllowedContentTypesOptions configures which requests the
+// AllowedContentTypes middleware checks.
+type AllowedContentTypesOptions struct {
+	// Methods are the request methods to check, defaulting to POST, PUT and
+	// PATCH, as other requests are not expected to have a body.
+	Methods []string
+
+	// ExcludeMethods are request methods not to check, taking precedence over
+	// Methods.
+	ExcludeMethods []string
+}
+
+// AllowedContentTypes is a middleware that rejects requests with a
+// Content-Type other than the given ones with 415 Unsupported Media Type.
+// Only requests with one of the methods configured in opts are checked, the
+// others pass through.
+func AllowedContentTypes(opts AllowedContentTypesOptions, contentTypes ...ContentType) func(next http.Handler) http.Handler {
+	methods := opts.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !containsMethod(methods, r.Method) || containsMethod(opts.ExcludeMethods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			requestContentType := RequestContentType(r)
+			for _, contentType := range contentTypes {
+				if requestContentType == contentType {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			RenderError(w, r, NewErrResponse(http.StatusUnsupportedMediaType, nil))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestContentType is a helper function that returns ContentType based on
 // context or request headers.
-func GetRequestContentType(r *http.Request) ContentType {
+func RequestContentType(r *http.Request) ContentType {
 	if contentType, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); ok {
 		return contentType
 	}
-	return GetContentType(r.Header.Get("Content-Type"))
+	return ContentTypeFromRequest(r)
 }
 
-func GetAcceptedContentType(r *http.Request) ContentType {
+// ContentTypeFromRequest returns the ContentType of the request Content-Type
+// header, ignoring media type parameters such as charset, even malformed
+// ones. It returns ContentTypeUnknown if the header is missing or its media
+// type is malformed.
+func ContentTypeFromRequest(r *http.Request) ContentType {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && err != mime.ErrInvalidMediaParameter {
+		return ContentTypeUnknown
+	}
+	return GetContentType(mediaType)
+}
+
+// AcceptedContentType is a helper function that returns the ContentType
+// accepted by the client, based on context or the request Accept header. It
+// defaults to ContentTypePlainText.
+func AcceptedContentType(r *http.Request) ContentType {
 	if contentType, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); ok {
 		return contentType
 	}
@@ -72,7 +207,7 @@ func GetAcceptedContentType(r *http.Request) ContentType {
 	var contentType ContentType
 
 	// Parse request Accept header.
-	fields := strings.Split(r.Header.Get("Accept"), ",")
+	fields := splitHeaderList(r.Header.Get("Accept"))
 	if len(fields) > 0 {
 		contentType = GetContentType(strings.TrimSpace(fields[0]))
 	}
@@ -82,3 +217,42 @@ func GetAcceptedContentType(r *http.Request) ContentType {
 	}
 	return contentType
 }
+
+// GetRequestContentType is a helper function that returns ContentType based on
+// context or request headers.
+//
+// Deprecated: use RequestContentType instead.
+func GetRequestContentType(r *http.Request) ContentType {
+	deprecated("GetRequestContentType", "RequestContentType")
+	return RequestContentType(r)
+}
+
+// GetAcceptedContentType is a helper function that returns the ContentType
+// accepted by the client.
+//
+// Deprecated: use AcceptedContentType instead.
+func GetAcceptedContentType(r *http.Request) ContentType {
+	deprecated("GetAcceptedContentType", "AcceptedContentType")
+	return AcceptedContentType(r)
+}
+
+// DeprecationWarnings enables logging a warning when deprecated functions of
+// this package are called, once per call site. Meant for development.
+var DeprecationWarnings = false
+
+var deprecationWarned sync.Map
+
+func deprecated(name, replacement string) {
+	if !DeprecationWarnings {
+		return
+	}
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		return
+	}
+	site := fmt.Sprintf("%s:%d", file, line)
+	if _, warned := deprecationWarned.LoadOrStore(site, struct{}{}); warned {
+		return
+	}
+	log.Printf("render: %s is deprecated, use %s instead (called from %s)", name, replacement, site)
+}
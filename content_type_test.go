@@ -0,0 +1,221 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentTypeFromRequest(t *testing.T) {
+	tests := []struct {
+		header string
+		want   ContentType
+	}{
+		{"application/json", ContentTypeJSON},
+		{"application/json; charset=utf-8", ContentTypeJSON},
+		{"Application/JSON;charset=UTF-8", ContentTypeJSON},
+		{"application/json; charset", ContentTypeJSON},
+		{"application/xml; charset=utf-8", ContentTypeXML},
+		{"application/x-www-form-urlencoded", ContentTypeForm},
+		{"", ContentTypeUnknown},
+		{"/json", ContentTypeUnknown},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Content-Type", tt.header)
+		if got := ContentTypeFromRequest(r); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+type namedPayload struct {
+	Name string `json:"name" xml:"name" form:"name"`
+}
+
+func (p *namedPayload) Bind(r *http.Request) error { return nil }
+
+func TestBindContentTypeParameters(t *testing.T) {
+	for _, header := range []string{"application/json; charset=utf-8", "application/json; charset"} {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+		r.Header.Set("Content-Type", header)
+		var p namedPayload
+		if err := Bind(r, &p); err != nil {
+			t.Errorf("%q: %v", header, err)
+			continue
+		}
+		if p.Name != "gopher" {
+			t.Errorf("%q: got %q, want gopher", header, p.Name)
+		}
+	}
+}
+
+func TestContentTypeJSONRoundTrip(t *testing.T) {
+	types := []ContentType{ContentTypeXML, ContentTypeJSON, ContentTypeEventStream, ContentTypeForm}
+	b, err := json.Marshal(types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `["application/xml","application/json","text/event-stream","application/x-www-form-urlencoded"]`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	var got []ContentType
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(types) {
+		t.Errorf("got %v, want %v", got, types)
+	}
+}
+
+func TestContentTypeText(t *testing.T) {
+	for ct := ContentTypePlainText; ct <= ContentTypeGRPCWebProto; ct++ {
+		text, err := ct.MarshalText()
+		if err != nil {
+			t.Fatalf("%d: %v", ct, err)
+		}
+		var got ContentType
+		if err := got.UnmarshalText(text); err != nil || got != ct {
+			t.Errorf("%s: got %v, %v", text, got, err)
+		}
+	}
+
+	if _, err := ContentTypeUnknown.MarshalText(); err == nil {
+		t.Error("marshalled ContentTypeUnknown")
+	}
+
+	tests := []struct {
+		text    string
+		want    ContentType
+		wantErr bool
+	}{
+		{"application/json; charset=utf-8", ContentTypeJSON, false},
+		{"text/xml", ContentTypeXML, false},
+		{"image/png", ContentTypeUnknown, true},
+		{"not a media type;", ContentTypeUnknown, true},
+	}
+	for _, tt := range tests {
+		var got ContentType
+		err := got.UnmarshalText([]byte(tt.text))
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: got %v, %v", tt.text, got, err)
+		}
+	}
+}
+
+func TestDeprecatedContentTypeHelpers(t *testing.T) {
+	defer func(enabled bool) { DeprecationWarnings = enabled }(DeprecationWarnings)
+	DeprecationWarnings = true
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	log.SetFlags(0)
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Content-Type", "application/xml")
+	r.Header.Set("Accept", "application/json")
+
+	for i := 0; i < 3; i++ {
+		if got := GetRequestContentType(r); got != ContentTypeXML {
+			t.Errorf("GetRequestContentType: got %v, want %v", got, ContentTypeXML)
+		}
+		if got := GetAcceptedContentType(r); got != ContentTypeJSON {
+			t.Errorf("GetAcceptedContentType: got %v, want %v", got, ContentTypeJSON)
+		}
+	}
+	GetRequestContentType(r) // another call site
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d warnings, want one per call site:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{"GetRequestContentType is deprecated, use RequestContentType", "GetAcceptedContentType is deprecated, use AcceptedContentType", "GetRequestContentType is deprecated"} {
+		if !strings.Contains(lines[i], want) || !strings.Contains(lines[i], "content_type_test.go:") {
+			t.Errorf("warning %d: got %q, want %q", i, lines[i], want)
+		}
+	}
+
+	DeprecationWarnings = false
+	buf.Reset()
+	GetAcceptedContentType(r)
+	if buf.Len() != 0 {
+		t.Errorf("got warning %q while disabled", buf.String())
+	}
+}
+
+func TestAllowedContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        AllowedContentTypesOptions
+		method      string
+		contentType string
+		want        int
+	}{
+		{"get without content type", AllowedContentTypesOptions{}, "GET", "", http.StatusOK},
+		{"post json", AllowedContentTypesOptions{}, "POST", "application/json; charset=utf-8", http.StatusOK},
+		{"post wrong type", AllowedContentTypesOptions{}, "POST", "text/plain", http.StatusUnsupportedMediaType},
+		{"patch without content type", AllowedContentTypesOptions{}, "PATCH", "", http.StatusUnsupportedMediaType},
+		{"configured methods", AllowedContentTypesOptions{Methods: []string{"delete"}}, "DELETE", "text/plain", http.StatusUnsupportedMediaType},
+		{"method not configured", AllowedContentTypesOptions{Methods: []string{"DELETE"}}, "POST", "text/plain", http.StatusOK},
+		{"excluded method", AllowedContentTypesOptions{ExcludeMethods: []string{"PUT"}}, "PUT", "text/plain", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			AllowedContentTypes(tt.opts, ContentTypeJSON)(http.HandlerFunc(okHandler)).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithContentType(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download" {
+			r = WithContentType(r, ContentTypeXML)
+		}
+		Respond(w, r, &namedPayload{Name: "gopher"})
+	})
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/download", "application/xml"},
+		{"/other", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("got Content-Type %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithContentTypeCopy(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	forced := WithContentType(r, ContentTypeXML)
+	if got := RequestContentType(forced); got != ContentTypeXML {
+		t.Errorf("got %v, want the forced content type", got)
+	}
+	if _, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); ok {
+		t.Error("original request modified")
+	}
+}
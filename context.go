@@ -0,0 +1,37 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// PayloadCtxKey is a context key to record a JSON encoded payload, see
+// EncodeToContext.
+var PayloadCtxKey = &contextKey{"Payload"}
+
+// ErrPayloadNotFound is returned by DecodeFromContext when the context
+// carries no payload.
+var ErrPayloadNotFound = errors.New("render: no payload in context")
+
+// EncodeToContext returns a copy of ctx carrying 'v' encoded as JSON, e.g. to
+// hand a response payload over to downstream calls without HTTP plumbing.
+// The payload is encoded once, with encoding/json, so that it round-trips
+// regardless of the JSON naming strategy; it's safe for concurrent use.
+func EncodeToContext(ctx context.Context, v interface{}) (context.Context, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, PayloadCtxKey, json.RawMessage(b)), nil
+}
+
+// DecodeFromContext decodes the payload stored with EncodeToContext into
+// 'v', or returns ErrPayloadNotFound.
+func DecodeFromContext(ctx context.Context, v interface{}) error {
+	b, ok := ctx.Value(PayloadCtxKey).(json.RawMessage)
+	if !ok {
+		return ErrPayloadNotFound
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type contextOrder struct {
+	ID      int               `json:"id"`
+	Items   []contextItem     `json:"items"`
+	Meta    map[string]string `json:"meta"`
+	Placed  time.Time         `json:"placed"`
+	Comment *string           `json:"comment"`
+}
+
+type contextItem struct {
+	SKU string  `json:"sku"`
+	Qty int     `json:"qty"`
+	Sum float64 `json:"sum"`
+}
+
+func TestEncodeToContext(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+	SetJSONNamingStrategy(SnakeCaseNamer)
+
+	want := contextOrder{
+		ID:     1,
+		Items:  []contextItem{{"a", 2, 1.5}, {"b", 1, 3}},
+		Meta:   map[string]string{"source": "web"},
+		Placed: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	ctx, err := EncodeToContext(context.Background(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got contextOrder
+	if err := DecodeFromContext(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestEncodeToContextErrors(t *testing.T) {
+	var v contextOrder
+	if err := DecodeFromContext(context.Background(), &v); err != ErrPayloadNotFound {
+		t.Errorf("got %v, want ErrPayloadNotFound", err)
+	}
+	ctx := context.Background()
+	if got, err := EncodeToContext(ctx, make(chan int)); err == nil || got != ctx {
+		t.Errorf("got %v, want an error and the context as is", err)
+	}
+}
+
+func TestDecodeFromContextConcurrent(t *testing.T) {
+	ctx, err := EncodeToContext(context.Background(), contextOrder{ID: 1, Items: []contextItem{{SKU: "a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v contextOrder
+			if err := DecodeFromContext(ctx, &v); err != nil || v.ID != 1 || v.Items[0].SKU != "a" {
+				t.Errorf("got %+v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
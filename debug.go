@@ -0,0 +1,106 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+)
+
+// DebugMode enables the Debug middleware. Keep it off in production.
+var DebugMode = false
+
+// Debug is a middleware that, when DebugMode is on, adds the request as seen
+// by the server to the response, as a base64 encoded dump (without the body)
+// in the X-Debug-Request header, along with the response status code in the
+// X-Debug-Status header. When DebugMode is off, it's a no-op.
+func Debug(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !DebugMode {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		dump, err := httputil.DumpRequest(r, false)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ww := &hookWriter{ResponseWriter: w, beforeHeader: func(w http.ResponseWriter, status int) {
+			w.Header().Set("X-Debug-Request", base64.StdEncoding.EncodeToString(dump))
+			w.Header().Set("X-Debug-Status", strconv.Itoa(status))
+		}}
+		next.ServeHTTP(ww, r)
+		ww.flushHook(http.StatusOK)
+	}
+	return http.HandlerFunc(fn)
+}
+
+var debugPage = htmltemplate.Must(htmltemplate.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Method}} {{.URL}}</title></head>
+<body>
+<h1>{{.Method}} {{.URL}}</h1>
+<p>{{.Status}} in {{.Duration}}</p>
+<table><tr>
+<td valign="top"><h2>Request</h2><pre>{{.Request}}</pre></td>
+<td valign="top"><h2>Response</h2><pre>{{.Response}}</pre></td>
+</tr></table>
+</body>
+</html>
+`))
+
+// DebugHandler wraps h so that, when DebugMode is on, responses are replaced
+// by an HTML page showing the raw request and the raw response of h side by
+// side, along with the time it took, with the X-Debug-* headers of Debug.
+// When DebugMode is off, it's a passthrough.
+func DebugHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !DebugMode {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		reqDump, err := httputil.DumpRequest(r, true)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		bw := newBufferWriter()
+		start := time.Now()
+		h.ServeHTTP(bw, r)
+		duration := time.Since(start)
+
+		resp := &bytes.Buffer{}
+		fmt.Fprintf(resp, "%s %d %s\r\n", r.Proto, bw.Status(), http.StatusText(bw.Status()))
+		bw.Header().Write(resp) //nolint:errcheck
+		resp.WriteString("\r\n")
+		resp.Write(bw.body.Bytes())
+
+		page := &bytes.Buffer{}
+		err = debugPage.Execute(page, map[string]interface{}{
+			"Method":   r.Method,
+			"URL":      r.URL.String(),
+			"Status":   bw.Status(),
+			"Duration": duration,
+			"Request":  string(reqDump),
+			"Response": resp.String(),
+		})
+		if err != nil {
+			RenderError(w, r, err)
+			return
+		}
+
+		w.Header().Set("X-Debug-Request", base64.StdEncoding.EncodeToString(reqDump))
+		w.Header().Set("X-Debug-Status", strconv.Itoa(bw.Status()))
+		w.Header().Set("X-Debug-Duration", duration.String())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page.Bytes()) //nolint:errcheck
+	}
+	return http.HandlerFunc(fn)
+}
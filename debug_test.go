@@ -0,0 +1,104 @@
+package render
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebug(t *testing.T) {
+	defer func(enabled bool) { DebugMode = enabled }(DebugMode)
+	h := Debug(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondStatus(w, r, http.StatusCreated, M{"name": "gopher"})
+	}))
+
+	for _, enabled := range []bool{false, true} {
+		DebugMode = enabled
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/gophers?x=1", strings.NewReader(`{}`)))
+
+		if w.Code != http.StatusCreated || w.Body.String() != "{\"name\":\"gopher\"}\n" {
+			t.Errorf("debug %v: got %d %q, want the handler response", enabled, w.Code, w.Body.String())
+		}
+		if !enabled {
+			if _, ok := w.Header()["X-Debug-Request"]; ok {
+				t.Error("got X-Debug-Request in production mode")
+			}
+			if _, ok := w.Header()["X-Debug-Status"]; ok {
+				t.Error("got X-Debug-Status in production mode")
+			}
+			continue
+		}
+
+		dump, err := base64.StdEncoding.DecodeString(w.Header().Get("X-Debug-Request"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(dump), "POST /gophers?x=1 HTTP/1.1\r\n") {
+			t.Errorf("got dump %q", dump)
+		}
+		if status := w.Header().Get("X-Debug-Status"); status != "201" {
+			t.Errorf("got X-Debug-Status %q, want 201", status)
+		}
+	}
+}
+
+func TestDebugEmptyResponse(t *testing.T) {
+	defer func(enabled bool) { DebugMode = enabled }(DebugMode)
+	DebugMode = true
+
+	w := httptest.NewRecorder()
+	Debug(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if status := w.Header().Get("X-Debug-Status"); status != "200" {
+		t.Errorf("got X-Debug-Status %q, want 200", status)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	defer func(enabled bool) { DebugMode = enabled }(DebugMode)
+	h := DebugHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondStatus(w, r, http.StatusCreated, M{"name": "gopher"})
+	}))
+
+	DebugMode = false
+	want := httptest.NewRecorder()
+	RespondStatus(want, httptest.NewRequest("POST", "/", nil), http.StatusCreated, M{"name": "gopher"})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/gophers?x=1", strings.NewReader(`{"a":1}`)))
+	if w.Code != want.Code || w.Body.String() != want.Body.String() {
+		t.Errorf("production mode: got %d %q, want %d %q", w.Code, w.Body.String(), want.Code, want.Body.String())
+	}
+	for k := range w.Header() {
+		if strings.HasPrefix(k, "X-Debug-") {
+			t.Errorf("got %s in production mode", k)
+		}
+	}
+
+	DebugMode = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/gophers?x=1", strings.NewReader(`{"a":1}`)))
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if status := w.Header().Get("X-Debug-Status"); status != "201" {
+		t.Errorf("got X-Debug-Status %q, want 201", status)
+	}
+	for _, k := range []string{"X-Debug-Request", "X-Debug-Duration"} {
+		if w.Header().Get(k) == "" {
+			t.Errorf("got no %s header", k)
+		}
+	}
+	body := w.Body.String()
+	for _, s := range []string{
+		"<h1>POST /gophers?x=1</h1>",
+		"HTTP/1.1 201 Created",
+		`{&#34;a&#34;:1}`,
+		`{&#34;name&#34;:&#34;gopher&#34;}`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("page is missing %q:\n%s", s, body)
+		}
+	}
+}
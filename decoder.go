@@ -1,11 +1,18 @@
 package render
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/ajg/form"
 )
@@ -18,23 +25,85 @@ import (
 // bytes allowed to be read from the request body.
 var Decode = DefaultDecoder
 
+// Decoder decodes a request body into a given interface, e.g. DecodeJSON.
+// Decoders wrapping readers that must be closed, e.g. gzip, close them before
+// returning.
+type Decoder func(r io.Reader, v interface{}) error
+
+// Compile-time checks that the decoders can be used as Decoders.
+var (
+	_ Decoder = DecodeJSON
+	_ Decoder = DecodeXML
+	_ Decoder = DecodeForm
+	_ Decoder = DecodeJSONC
+	_ Decoder = DecodeJSONLocated
+	_ Decoder = DecodeJSONStrict
+	_ Decoder = DecodeJSONLenient
+	_ Decoder = DecodeGRPCWebJSON
+	_ Decoder = DecodeGRPCWebProto
+)
+
+// DecoderCtxKey is a context key to record a Decoder overriding the content
+// type based decoder selection.
+var DecoderCtxKey = &contextKey{"Decoder"}
+
+// WithDecoder returns a shallow copy of r with dec stored in its context.
+// DefaultDecoder will use dec to decode the request body, regardless of the
+// request Content-Type, e.g. for strict JSON decoding on admin endpoints.
+func WithDecoder(r *http.Request, dec Decoder) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), DecoderCtxKey, dec))
+}
+
 // DefaultDecoder detects the correct decoder for use on an HTTP request and
-// marshals into a given interface.
+// marshals into a given interface. A Decoder set with WithDecoder takes
+// precedence over the request Content-Type, followed by a Codec registered
+// for it.
 func DefaultDecoder(r *http.Request, v interface{}) error {
-	var err error
+	if dec, ok := r.Context().Value(DecoderCtxKey).(Decoder); ok {
+		return dec(r.Body, v)
+	}
 
-	switch GetRequestContentType(r) {
+	dec, ok := decoderFor(RequestContentType(r))
+	if !ok {
+		return errors.New("render: unable to automatically decode the request content type")
+	}
+	return dec(r.Body, v)
+}
+
+// DecodeAs decodes a given reader of the given content type into an
+// interface, the same way DefaultDecoder decodes request bodies of that
+// content type, e.g. to test decoding without a HTTP request.
+func DecodeAs(r io.Reader, contentType ContentType, v interface{}) error {
+	dec, ok := decoderFor(contentType)
+	if !ok {
+		return fmt.Errorf("render: unable to decode content type %q", contentType)
+	}
+	return dec(r, v)
+}
+
+// decoderFor returns the Decoder of the given content type: the one of the
+// Codec registered for it, if any, or the built-in one.
+func decoderFor(ct ContentType) (Decoder, bool) {
+	if c, ok := LookupCodec(ct); ok && c.Decoder != nil {
+		return c.Decoder, true
+	}
+
+	switch ct {
 	case ContentTypeJSON:
-		err = DecodeJSON(r.Body, v)
+		return DecodeJSON, true
 	case ContentTypeXML:
-		err = DecodeXML(r.Body, v)
+		return DecodeXML, true
 	case ContentTypeForm:
-		err = DecodeForm(r.Body, v)
+		return DecodeForm, true
+	case ContentTypeJSONC:
+		return DecodeJSONC, true
+	case ContentTypeGRPCWebJSON:
+		return DecodeGRPCWebJSON, true
+	case ContentTypeGRPCWebProto:
+		return DecodeGRPCWebProto, true
 	default:
-		err = errors.New("render: unable to automatically decode the request content type")
+		return nil, false
 	}
-
-	return err
 }
 
 // DecodeJSON decodes a given reader into an interface using the json decoder.
@@ -43,6 +112,15 @@ func DecodeJSON(r io.Reader, v interface{}) error {
 	return json.NewDecoder(r).Decode(v)
 }
 
+// DecodeJSONStrict is like DecodeJSON, but fails on object keys not matching
+// any field of the destination struct.
+func DecodeJSONStrict(r io.Reader, v interface{}) error {
+	defer io.Copy(io.Discard, r) //nolint:errcheck
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
 // DecodeXML decodes a given reader into an interface using the xml decoder.
 func DecodeXML(r io.Reader, v interface{}) error {
 	defer io.Copy(io.Discard, r) //nolint:errcheck
@@ -54,3 +132,239 @@ func DecodeForm(r io.Reader, v interface{}) error {
 	decoder := form.NewDecoder(r) //nolint:errcheck
 	return decoder.Decode(v)
 }
+
+// InspectBody wraps the request body so that fn receives a copy of the raw
+// bytes once the body has been consumed, e.g. after Bind or Decode is done
+// reading it, successfully or not. Unlike buffering the body, it does not
+// allow the body to be read again; it's purely observational, which makes it
+// handy for logging payloads while debugging.
+func InspectBody(r *http.Request, fn func(body []byte)) *http.Request {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Body = &bodyInspectReader{ReadCloser: r.Body, fn: fn}
+	return r2
+}
+
+// bodyInspectReader tees everything read from the underlying body into a
+// buffer and hands it over to fn on EOF, on a read error or on Close,
+// whichever comes first.
+type bodyInspectReader struct {
+	io.ReadCloser
+	fn   func(body []byte)
+	buf  bytes.Buffer
+	done bool
+}
+
+func (b *bodyInspectReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err != nil {
+		b.inspect()
+	}
+	return n, err
+}
+
+func (b *bodyInspectReader) Close() error {
+	b.inspect()
+	return b.ReadCloser.Close()
+}
+
+func (b *bodyInspectReader) inspect() {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.fn(b.buf.Bytes())
+}
+
+// MinBodyBytes is a middleware that rejects requests with a body shorter than
+// n bytes, responding with 411 Length Required when the request carries no
+// length information at all and 400 Bad Request otherwise. Bodies of unknown
+// length, e.g. with chunked transfer encoding, are read up to n bytes to check
+// and re-buffered for the next handler.
+func MinBodyBytes(n int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.ContentLength == 0 && r.Header.Get("Content-Length") == "" && len(r.TransferEncoding) == 0:
+				if n > 0 {
+					RenderError(w, r, NewErrResponse(http.StatusLengthRequired, nil))
+					return
+				}
+
+			case r.ContentLength >= 0:
+				if r.ContentLength < n {
+					RenderError(w, r, NewErrResponse(http.StatusBadRequest, fmt.Errorf("render: request body must be at least %d bytes", n)))
+					return
+				}
+
+			default:
+				buf := make([]byte, n)
+				read, err := io.ReadFull(r.Body, buf)
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					RenderError(w, r, NewErrResponse(http.StatusBadRequest, fmt.Errorf("render: request body must be at least %d bytes", n)))
+					return
+				}
+				if err != nil {
+					RenderError(w, r, NewErrResponse(http.StatusBadRequest, err))
+					return
+				}
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf[:read]), r.Body), r.Body}
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// MaxDecompressedRequestSize is the maximum size, in bytes, of request bodies
+// once decompressed by DecompressRequest, 10 MiB by default, guarding against
+// small bodies expanding to exhaust memory. Zero or less means no limit.
+var MaxDecompressedRequestSize int64 = 10 << 20
+
+// DecompressRequest is a middleware transparently decompressing request
+// bodies sent with a gzip or deflate Content-Encoding, so that decoders get
+// the plain body. Requests with other encodings, e.g. br which would require a
+// third-party package, are rejected with 415 Unsupported Media Type. Reading
+// more than MaxDecompressedRequestSize bytes from the decompressed body fails
+// with the error of http.MaxBytesReader, "http: request body too large".
+func DecompressRequest(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		var body io.ReadCloser
+		switch encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				RenderError(w, r, NewErrResponse(http.StatusBadRequest, err))
+				return
+			}
+			body = zr
+		case "deflate":
+			body = flate.NewReader(r.Body)
+		default:
+			RenderError(w, r, NewErrResponse(http.StatusUnsupportedMediaType, fmt.Errorf("render: unsupported content encoding %q", encoding)))
+			return
+		}
+
+		var plain io.Reader = body
+		if MaxDecompressedRequestSize > 0 {
+			plain = http.MaxBytesReader(w, body, MaxDecompressedRequestSize)
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{plain, closers{body, r.Body}}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// closers closes all of its members, returning the first error.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var first error
+	for _, closer := range c {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// LocatedDecodeError is a decoding error along with the line and column, both
+// starting at 1, of the request body where it occurred.
+type LocatedDecodeError struct {
+	Line   int
+	Column int
+	Cause  error
+}
+
+func (e *LocatedDecodeError) Error() string {
+	return fmt.Sprintf("render: line %d, column %d: %v", e.Line, e.Column, e.Cause)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *LocatedDecodeError) Unwrap() error {
+	return e.Cause
+}
+
+// DecodeJSONLocated is like DecodeJSON, but reports JSON syntax errors as a
+// *LocatedDecodeError pointing at the line and column of the error, which is
+// friendlier to humans than a byte offset. Other errors are returned as is.
+// Use it with WithDecoder, or from a custom Decode function.
+func DecodeJSONLocated(r io.Reader, v interface{}) error {
+	buf := &bytes.Buffer{}
+	err := DecodeJSON(io.TeeReader(r, buf), v)
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	// Offset is the number of bytes read when the error occurred, so the
+	// offending byte is the one right before.
+	b := buf.Bytes()
+	pos := int(syntaxErr.Offset) - 1
+	if pos > len(b) {
+		pos = len(b)
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	line := 1 + bytes.Count(b[:pos], []byte("\n"))
+	column := pos - bytes.LastIndexByte(b[:pos], '\n')
+	return &LocatedDecodeError{Line: line, Column: column, Cause: err}
+}
+
+// StreamingDecode passes a json.Decoder reading the request body to fn, for
+// token by token processing of large bodies without loading them in memory.
+// The request body is closed once fn returns.
+func StreamingDecode(r *http.Request, fn func(dec *json.Decoder) error) error {
+	defer r.Body.Close()
+	return fn(json.NewDecoder(r.Body))
+}
+
+// StreamingDecodeAll decodes a stream of JSON values, e.g. newline-delimited
+// JSON, from the request body and calls fn with each of them. v must be a
+// pointer, e.g. new(Item); each item is decoded into a fresh value of the same
+// type, which is passed to fn. Decoding stops at the end of the body, on the
+// first error, including from fn, or when the request context is done. The
+// request body is closed once done.
+func StreamingDecodeAll(r *http.Request, v interface{}, fn func(item interface{}) error) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return errors.New("render: StreamingDecodeAll expects a pointer")
+	}
+
+	return StreamingDecode(r, func(dec *json.Decoder) error {
+		ctx := r.Context()
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := reflect.New(t.Elem()).Interface()
+			if err := dec.Decode(item); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	})
+}
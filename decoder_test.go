@@ -0,0 +1,399 @@
+package render
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressed(t *testing.T, encoding string, data []byte) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	var zw io.WriteCloser
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(buf)
+	case "deflate":
+		var err error
+		if zw, err = flate.NewWriter(buf, flate.BestCompression); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// decompressBind binds the request through DecompressRequest, returning the
+// response and the binding error.
+func decompressBind(r *http.Request) (*httptest.ResponseRecorder, *namedPayload, error) {
+	var (
+		p   namedPayload
+		err error
+	)
+	w := httptest.NewRecorder()
+	DecompressRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			err = errors.New("Content-Encoding not removed")
+			return
+		}
+		err = Bind(r, &p)
+	})).ServeHTTP(w, r)
+	return w, &p, err
+}
+
+func TestDecompressRequest(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate", ""} {
+		t.Run(encoding, func(t *testing.T) {
+			body := bytes.NewBufferString(`{"name":"gopher"}`)
+			if encoding != "" {
+				body = compressed(t, encoding, body.Bytes())
+			}
+			r := httptest.NewRequest("POST", "/", body)
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Content-Encoding", encoding)
+
+			_, p, err := decompressBind(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != "gopher" {
+				t.Errorf("got %q, want gopher", p.Name)
+			}
+		})
+	}
+}
+
+func TestDecompressRequestRejected(t *testing.T) {
+	tests := []struct {
+		encoding string
+		body     string
+		want     int
+	}{
+		{"br", "x", http.StatusUnsupportedMediaType},
+		{"gzip", "not gzip", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		r.Header.Set("Content-Encoding", tt.encoding)
+		w, _, _ := decompressBind(r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.encoding, w.Code, tt.want)
+		}
+	}
+}
+
+func TestDecompressRequestMaxSize(t *testing.T) {
+	defer func(n int64) { MaxDecompressedRequestSize = n }(MaxDecompressedRequestSize)
+	MaxDecompressedRequestSize = 1 << 10
+
+	// A few hundred bytes expanding to 1 MiB.
+	bomb := `{"name":"` + strings.Repeat("a", 1<<20) + `"}`
+	body := compressed(t, "gzip", []byte(bomb))
+	r := httptest.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+
+	_, _, err := decompressBind(r)
+	// Not *http.MaxBytesError, which only exists as of Go 1.19.
+	if err == nil || !strings.Contains(err.Error(), "http: request body too large") {
+		t.Errorf("got %v, want the error of http.MaxBytesReader", err)
+	}
+
+	MaxDecompressedRequestSize = 0
+	r = httptest.NewRequest("POST", "/", compressed(t, "gzip", []byte(bomb)))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	if _, p, err := decompressBind(r); err != nil || len(p.Name) != 1<<20 {
+		t.Errorf("without limit: got %d bytes, %v", len(p.Name), err)
+	}
+}
+
+func TestInspectBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"valid", `{"name":"gopher"}`, false},
+		{"parse error", `{"name":`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got   []byte
+				calls int
+			)
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r = InspectBody(r, func(body []byte) {
+				calls++
+				got = append([]byte(nil), body...)
+			})
+
+			var p namedPayload
+			if err := Bind(r, &p); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			r.Body.Close()
+			if calls != 1 {
+				t.Errorf("fn called %d times, want 1", calls)
+			}
+			if string(got) != tt.body {
+				t.Errorf("got %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestInspectBodyNoBody(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := InspectBody(r, func([]byte) { t.Error("fn called") }); got != r {
+		t.Error("got a new request for a request without body")
+	}
+}
+
+func TestWithDecoder(t *testing.T) {
+	var used []string
+	named := func(name string) Decoder {
+		return func(r io.Reader, v interface{}) error {
+			used = append(used, name)
+			return DecodeJSON(r, v)
+		}
+	}
+
+	tests := []struct {
+		name string
+		r    func(r *http.Request) *http.Request
+		want string
+	}{
+		{"content type", func(r *http.Request) *http.Request { return r }, ""},
+		{"context", func(r *http.Request) *http.Request { return WithDecoder(r, named("a")) }, "a"},
+		{"nested", func(r *http.Request) *http.Request { return WithDecoder(WithDecoder(r, named("a")), named("b")) }, "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used = nil
+			// The Content-Type would pick the form decoder, failing on JSON.
+			r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			var p namedPayload
+			err := DefaultDecoder(tt.r(r), &p)
+			if tt.want == "" {
+				if len(used) != 0 {
+					t.Errorf("got decoders %v, want none", used)
+				}
+				return
+			}
+			if err != nil || p.Name != "gopher" {
+				t.Errorf("got %+v, %v", p, err)
+			}
+			if len(used) != 1 || used[0] != tt.want {
+				t.Errorf("got decoders %v, want %s", used, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinBodyBytes(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		noLength   bool
+		wantStatus int
+	}{
+		{"short content length", "abc", false, false, http.StatusBadRequest},
+		{"short chunked", "abc", true, false, http.StatusBadRequest},
+		{"exact content length", "abcd", false, false, http.StatusOK},
+		{"exact chunked", "abcd", true, false, http.StatusOK},
+		{"longer chunked", "abcdefgh", true, false, http.StatusOK},
+		{"no length", "", false, true, http.StatusLengthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			switch {
+			case tt.chunked:
+				r.ContentLength = -1
+				r.TransferEncoding = []string{"chunked"}
+			case tt.noLength:
+				r.ContentLength = 0
+				r.Header.Del("Content-Length")
+			}
+
+			var body []byte
+			w := httptest.NewRecorder()
+			MinBodyBytes(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && string(body) != tt.body {
+				t.Errorf("handler read %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONLocated(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		line, col int
+	}{
+		{"line 3", "{\n  \"a\": 1,\n    x\n}", 3, 5},
+		{"line 1", `{"a": x}`, 1, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]int
+			err := DecodeJSONLocated(strings.NewReader(tt.body), &v)
+			var located *LocatedDecodeError
+			if !errors.As(err, &located) {
+				t.Fatalf("got %v, want a *LocatedDecodeError", err)
+			}
+			if located.Line != tt.line || located.Column != tt.col {
+				t.Errorf("got line %d, column %d, want line %d, column %d", located.Line, located.Column, tt.line, tt.col)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONLocatedPassThrough(t *testing.T) {
+	var v struct{ A int }
+	err := DecodeJSONLocated(strings.NewReader(`{"A": "x"}`), &v)
+	var located *LocatedDecodeError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &located) || !errors.As(err, &typeErr) {
+		t.Errorf("got %v, want the *json.UnmarshalTypeError as is", err)
+	}
+}
+
+// closeTracker is a request body recording whether it was closed.
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed = true
+	return nil
+}
+
+func streamingRequest(body string) (*http.Request, *closeTracker) {
+	tracker := &closeTracker{Reader: strings.NewReader(body)}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Body = tracker
+	return r, tracker
+}
+
+func TestStreamingDecode(t *testing.T) {
+	r, body := streamingRequest(`[{"name":"a"},{"name":"b"},{"name":"c"}]`)
+	var first namedPayload
+	err := StreamingDecode(r, func(dec *json.Decoder) error {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		return dec.Decode(&first)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "a" {
+		t.Errorf("got %q, want a", first.Name)
+	}
+	if !body.closed {
+		t.Error("request body not closed")
+	}
+}
+
+func TestStreamingDecodeAll(t *testing.T) {
+	r, body := streamingRequest("{\"name\":\"a\"}\n{\"name\":\"b\"}\n{\"name\":\"c\"}\n")
+	var names []string
+	err := StreamingDecodeAll(r, new(namedPayload), func(item interface{}) error {
+		names = append(names, item.(*namedPayload).Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "a,b,c" {
+		t.Errorf("got %s, want a,b,c", got)
+	}
+	if !body.closed {
+		t.Error("request body not closed")
+	}
+}
+
+func TestStreamingDecodeAllCanceled(t *testing.T) {
+	r, body := streamingRequest("{\"name\":\"a\"}\n{\"name\":\"b\"}\n")
+	ctx, cancel := context.WithCancel(r.Context())
+	r = r.WithContext(ctx)
+
+	var names []string
+	err := StreamingDecodeAll(r, new(namedPayload), func(item interface{}) error {
+		names = append(names, item.(*namedPayload).Name)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if len(names) != 1 {
+		t.Errorf("got items %v, want only the first one", names)
+	}
+	if !body.closed {
+		t.Error("request body not closed")
+	}
+}
+
+func TestStreamingDecodeAllNotPointer(t *testing.T) {
+	r, _ := streamingRequest(`{}`)
+	if err := StreamingDecodeAll(r, namedPayload{}, func(interface{}) error { return nil }); err == nil {
+		t.Error("got no error for a non-pointer value")
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	tests := []struct {
+		name string
+		ct   ContentType
+		body string
+	}{
+		{"json", ContentTypeJSON, `{"name":"gopher"}`},
+		{"xml", ContentTypeXML, `<namedPayload><name>gopher</name></namedPayload>`},
+		{"form", ContentTypeForm, `name=gopher`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p namedPayload
+			if err := DecodeAs(strings.NewReader(tt.body), tt.ct, &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != "gopher" {
+				t.Errorf("got %+v", p)
+			}
+		})
+	}
+
+	var p namedPayload
+	if err := DecodeAs(strings.NewReader(`{}`), ContentTypeUnknown, &p); err == nil {
+		t.Error("got no error for an unknown content type")
+	}
+}
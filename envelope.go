@@ -0,0 +1,44 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Envelope is a middleware that wraps JSON responses into a standard
+// envelope, e.g. {"data": <payload>, "meta": {...}}, where meta is populated
+// by metaFn, e.g. with the request ID. Responses of other content types pass
+// through unchanged.
+//
+// As the whole response is buffered, it's not suitable for streaming
+// responses.
+func Envelope(metaFn func(r *http.Request) map[string]interface{}) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			bw := newBufferWriter()
+			next.ServeHTTP(bw, r)
+
+			body := bw.body.Bytes()
+			if GetContentType(bw.Header().Get("Content-Type")) != ContentTypeJSON || !json.Valid(body) {
+				bw.writeTo(w, body)
+				return
+			}
+
+			var meta map[string]interface{}
+			if metaFn != nil {
+				meta = metaFn(r)
+			}
+			b, err := json.Marshal(struct {
+				Data json.RawMessage        `json:"data"`
+				Meta map[string]interface{} `json:"meta"`
+			}{json.RawMessage(body), meta})
+			if err != nil {
+				bw.writeTo(w, body)
+				return
+			}
+			bw.Header().Del("Content-Length")
+			bw.writeTo(w, b)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	meta := func(r *http.Request) map[string]interface{} {
+		return map[string]interface{}{"path": r.URL.Path}
+	}
+	tests := []struct {
+		name       string
+		metaFn     func(r *http.Request) map[string]interface{}
+		respond    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantBody   string
+	}{
+		{"json", meta, func(w http.ResponseWriter, r *http.Request) {
+			RespondStatus(w, r, http.StatusCreated, M{"name": "gopher"})
+		}, http.StatusCreated, `{"data":{"name":"gopher"},"meta":{"path":"/gophers"}}`},
+		{"indented json", meta, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{\n  \"name\": \"gopher\"\n}\n"))
+		}, http.StatusOK, `{"data":{"name":"gopher"},"meta":{"path":"/gophers"}}`},
+		{"nil meta", nil, func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, []int{1})
+		}, http.StatusOK, `{"data":[1],"meta":null}`},
+		{"plain text", meta, func(w http.ResponseWriter, r *http.Request) {
+			PlainText(w, r, `{"name":"gopher"}`)
+		}, http.StatusOK, `{"name":"gopher"}`},
+		{"invalid json", meta, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":`))
+		}, http.StatusOK, `{"name":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Envelope(tt.metaFn)(http.HandlerFunc(tt.respond)).ServeHTTP(w, httptest.NewRequest("GET", "/gophers", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package render
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// OnError is a package-level hook called with errors that can't be reported
+// back to the client, such as recovered panics. It's nil by default; set it
+// to hook up your own logger.
+var OnError func(r *http.Request, err error)
+
+// reportError passes err to OnError, if set, prefixed with the request ID.
+func reportError(r *http.Request, err error) {
+	if OnError == nil {
+		return
+	}
+	if id := GetRequestID(r); id != "" {
+		err = fmt.Errorf("request %s: %w", id, err)
+	}
+	OnError(r, err)
+}
+
+// ErrResponse is a Renderer for error payloads, loosely modelled after the
+// RFC 7807 problem details object. It's encoded as application/problem+xml
+// for clients accepting XML, and as application/problem+json otherwise.
+type ErrResponse struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Err     error    `json:"-" xml:"-"`
+
+	Status int    `json:"status" xml:"status"`
+	Title  string `json:"title" xml:"title"`
+	Detail string `json:"detail,omitempty" xml:"detail,omitempty"`
+}
+
+// NewErrResponse returns an ErrResponse for the given HTTP status code, using
+// the error message as detail.
+func NewErrResponse(status int, err error) *ErrResponse {
+	e := &ErrResponse{
+		Err:    err,
+		Status: status,
+		Title:  StatusText(status),
+	}
+	if err != nil {
+		e.Detail = err.Error()
+	}
+	return e
+}
+
+// Render sets the response status code hint and the title, as per
+// WithStatusText or StatusText, unless already set. It also selects the
+// problem details encoder, unless another Encoder was set with WithEncoder.
+func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if text, ok := r.Context().Value(StatusTextCtxKey).(string); ok {
+		e.Title = text
+	} else if e.Title == "" {
+		e.Title = StatusText(e.Status)
+	}
+	Status(r, e.Status)
+
+	if _, ok := r.Context().Value(EncoderCtxKey).(Encoder); !ok {
+		enc := ProblemJSON
+		if ct, _ := negotiateResponse(r, []ContentType{ContentTypeJSON, ContentTypeXML}); ct == ContentTypeXML {
+			enc = ProblemXML
+		}
+		*r = *WithEncoder(r, enc)
+	}
+	return nil
+}
+
+// ProblemJSON writes 'v' as JSON, like JSON, but setting the Content-Type as
+// application/problem+json, as per RFC 7807.
+func ProblemJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	ww := problemWriter(w, ContentTypeJSON, "application/problem+json")
+	JSON(ww, r, v)
+	ww.flushHook(http.StatusOK)
+}
+
+// ProblemXML writes 'v' as XML, like XML, but setting the Content-Type as
+// application/problem+xml, as per RFC 7807.
+func ProblemXML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	ww := problemWriter(w, ContentTypeXML, "application/problem+xml")
+	XML(ww, r, v)
+	ww.flushHook(http.StatusOK)
+}
+
+// problemWriter replaces the Content-Type set by the JSON or XML responders
+// with the problem details media type. Error responses of the responders
+// themselves are left alone.
+func problemWriter(w http.ResponseWriter, from ContentType, mediaType string) *hookWriter {
+	return &hookWriter{ResponseWriter: w, beforeHeader: func(w http.ResponseWriter, status int) {
+		if GetContentType(w.Header().Get("Content-Type")) == from {
+			w.Header().Set("Content-Type", contentType(mediaType))
+		}
+	}}
+}
+
+func (e *ErrResponse) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Title
+}
+
+// Unwrap returns the underlying error.
+func (e *ErrResponse) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is an error carrying its own HTTP status code.
+type StatusError interface {
+	StatusCode() int
+	Error() string
+}
+
+// RenderError renders err to the client. An *ErrResponse is rendered as is,
+// a StatusError results in a response with its status code, a gRPC status
+// error as per GRPCErrorRenderer, and any other error results in a response
+// with the status code of StatusFromError. The message of the latter is only
+// sent as detail for client errors, below 500.
+func RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	Render(w, r, toErrResponse(err)) //nolint:errcheck
+}
+
+func toErrResponse(err error) *ErrResponse {
+	if e, ok := err.(*ErrResponse); ok {
+		return e
+	}
+	if se, ok := err.(StatusError); ok {
+		return NewErrResponse(se.StatusCode(), err)
+	}
+	if e := grpcErrResponse(err); e != nil {
+		return e
+	}
+	e := NewErrResponse(StatusFromError(err), err)
+	if e.Status >= http.StatusInternalServerError {
+		// Messages of unexpected errors, e.g. from database drivers, are
+		// meant for the logs, not for clients.
+		e.Detail = ""
+	}
+	return e
+}
+
+// StatusClientClosedRequest is the non-standard 499 status code, used for
+// requests canceled by the client before a response could be sent.
+const StatusClientClosedRequest = 499
+
+// ErrorMapping maps errors matching Err, as per errors.Is, to the HTTP status
+// code of their response. In a list of mappings, the first one matching an
+// error wins, e.g. for errors wrapping several sentinel errors.
+type ErrorMapping struct {
+	Err    error
+	Status int
+}
+
+// DefaultErrorMapping maps common sentinel errors to the HTTP status code of
+// their response, see StatusFromError.
+var DefaultErrorMapping = []ErrorMapping{
+	{sql.ErrNoRows, http.StatusNotFound},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable},
+	{context.Canceled, StatusClientClosedRequest},
+	{os.ErrPermission, http.StatusForbidden},
+	{os.ErrNotExist, http.StatusNotFound},
+}
+
+var (
+	errorStatusMu sync.RWMutex
+	errorStatus   []ErrorMapping
+)
+
+// RegisterErrorStatus maps err, and errors wrapping it, to the given HTTP
+// status code in StatusFromError, taking precedence over DefaultErrorMapping.
+// Errors registered first take precedence over the ones registered later;
+// registering err again only updates its status code.
+func RegisterErrorStatus(err error, status int) {
+	errorStatusMu.Lock()
+	defer errorStatusMu.Unlock()
+	for i := range errorStatus {
+		if errorStatus[i].Err == err {
+			errorStatus[i].Status = status
+			return
+		}
+	}
+	errorStatus = append(errorStatus, ErrorMapping{err, status})
+}
+
+// StatusFromError returns the HTTP status code of err as per the errors
+// registered with RegisterErrorStatus, then DefaultErrorMapping, comparing
+// errors with errors.Is, the first match winning. It defaults to 500
+// Internal Server Error.
+func StatusFromError(err error) int {
+	errorStatusMu.RLock()
+	status, ok := mapError(errorStatus, err)
+	errorStatusMu.RUnlock()
+	if ok {
+		return status
+	}
+	if status, ok := mapError(DefaultErrorMapping, err); ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// HandlerErrorCtxKey is a context key to record the error of a handler.
+var HandlerErrorCtxKey = &contextKey{"HandlerError"}
+
+// SetHandlerError records err as the error of the handler, which the
+// ErrorHandler middleware renders once the handler returns. It's a no-op
+// outside of ErrorHandler.
+func SetHandlerError(r *http.Request, err error) {
+	if holder, ok := r.Context().Value(HandlerErrorCtxKey).(*error); ok {
+		*holder = err
+	}
+}
+
+// GetHandlerError returns the error recorded with SetHandlerError, or nil.
+func GetHandlerError(r *http.Request) error {
+	if holder, ok := r.Context().Value(HandlerErrorCtxKey).(*error); ok {
+		return *holder
+	}
+	return nil
+}
+
+// ErrorHandler is a middleware rendering the error recorded by the handler
+// with SetHandlerError, unless the handler wrote a response already. The
+// status code is the one of the first of mapping matching the error, as per
+// errors.Is; errors not found there are handled as per RenderError, e.g. with
+// the status code of StatusFromError.
+func ErrorHandler(mapping []ErrorMapping) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			holder := new(error)
+			r = r.WithContext(context.WithValue(r.Context(), HandlerErrorCtxKey, holder))
+			ww := &hookWriter{ResponseWriter: w, beforeHeader: func(http.ResponseWriter, int) {}}
+			next.ServeHTTP(ww, r)
+
+			err := *holder
+			if err == nil || ww.wroteHeader {
+				return
+			}
+			if status, ok := mapError(mapping, err); ok {
+				err = NewErrResponse(status, err)
+			}
+			RenderError(w, r, err)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func mapError(mapping []ErrorMapping, err error) (int, bool) {
+	for _, m := range mapping {
+		if errors.Is(err, m.Err) {
+			return m.Status, true
+		}
+	}
+	return 0, false
+}
+
+// Recover is a middleware that recovers from panics, reports them along with
+// the stack trace to OnError and responds with a 500 ErrResponse, encoded as
+// per the request Accept header. The panic value is not exposed to the client.
+//
+// Panics with http.ErrAbortHandler are left alone, as net/http relies on them
+// to abort a response.
+func Recover(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			err, ok := rvr.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rvr)
+			}
+			reportError(r, fmt.Errorf("render: panic: %w\n%s", err, debug.Stack()))
+
+			RenderError(w, r, &ErrResponse{Err: err, Status: http.StatusInternalServerError})
+		}()
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
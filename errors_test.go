@@ -0,0 +1,347 @@
+package render
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "no such gopher" }
+func (notFoundError) StatusCode() int { return http.StatusNotFound }
+
+type renderableError struct{}
+
+func (renderableError) Error() string { return "renderable" }
+func (renderableError) Render(w http.ResponseWriter, r *http.Request) error {
+	Status(r, http.StatusTeapot)
+	return nil
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	return problem
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantDetail interface{}
+	}{
+		{"plain", errors.New("db down"), http.StatusInternalServerError, nil},
+		{"status error", notFoundError{}, http.StatusNotFound, "no such gopher"},
+		{"mapped", errTestConflict, http.StatusConflict, "conflict"},
+	}
+	RegisterErrorStatus(errTestConflict, http.StatusConflict)
+	defer unregisterErrorStatus(errTestConflict)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, httptest.NewRequest("GET", "/", nil), tt.err)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json; charset=utf-8" {
+				t.Errorf("got Content-Type %q", ct)
+			}
+			problem := decodeProblem(t, w)
+			if problem["detail"] != tt.wantDetail {
+				t.Errorf("got detail %v, want %v", problem["detail"], tt.wantDetail)
+			}
+			if problem["status"] != float64(tt.wantStatus) {
+				t.Errorf("got status %v in body", problem["status"])
+			}
+		})
+	}
+}
+
+// fieldsError is an error with exported fields, encoded as is.
+type fieldsError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *fieldsError) Error() string { return e.Message }
+
+// marshaledError is an error encoding itself.
+// bothErrors matches both of its errors, as per errors.Is.
+type bothErrors [2]error
+
+func (e bothErrors) Error() string { return e[0].Error() + ": " + e[1].Error() }
+
+func (e bothErrors) Is(target error) bool {
+	return errors.Is(e[0], target) || errors.Is(e[1], target)
+}
+
+type marshaledError struct{ msg string }
+
+func (e marshaledError) Error() string                { return e.msg }
+func (e marshaledError) MarshalJSON() ([]byte, error) { return json.Marshal(e.msg) }
+
+func TestRespondErrorWithFields(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"exported fields", &fieldsError{"E42", "db down"}, `{"code":"E42","message":"db down"}`},
+		{"marshaler", marshaledError{"db down"}, `"db down"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, httptest.NewRequest("GET", "/", nil), tt.err)
+			if w.Code != http.StatusOK {
+				t.Errorf("got status %d, want 200", w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+var errTestConflict = errors.New("conflict")
+
+func unregisterErrorStatus(err error) {
+	errorStatusMu.Lock()
+	defer errorStatusMu.Unlock()
+	for i, m := range errorStatus {
+		if m.Err == err {
+			errorStatus = append(errorStatus[:i:i], errorStatus[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestRespondRendererError(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	Render(w, r, renderableError{}) //nolint:errcheck
+	if w.Code != http.StatusTeapot {
+		t.Errorf("got status %d, want the Renderer's %d", w.Code, http.StatusTeapot)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want the value encoded as is", ct)
+	}
+}
+
+func TestRenderErrorHidesInternalDetail(t *testing.T) {
+	w := httptest.NewRecorder()
+	RenderError(w, httptest.NewRequest("GET", "/", nil), errors.New(`pq: relation "users" does not exist`))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", w.Code)
+	}
+	if _, ok := decodeProblem(t, w)["detail"]; ok {
+		t.Errorf("internal error message leaked: %s", w.Body.String())
+	}
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic interface{}
+	}{
+		{"string", "oops"},
+		{"error", errors.New("oops")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			defer captureErrors(&errs)()
+
+			w := httptest.NewRecorder()
+			Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(tt.panic)
+			})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("got status %d, want 500", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json; charset=utf-8" {
+				t.Errorf("got Content-Type %q", ct)
+			}
+			if problem := decodeProblem(t, w); problem["detail"] != nil {
+				t.Errorf("got detail %v, want the panic value hidden", problem["detail"])
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), "oops") || !strings.Contains(errs[0].Error(), "goroutine") {
+				t.Errorf("got errors %v, want the panic and its stack trace", errs)
+			}
+		})
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler", rvr)
+		}
+	}()
+	Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestErrResponseProblemTypes(t *testing.T) {
+	tests := []struct {
+		accept   string
+		wantType string
+	}{
+		{"application/json", "application/problem+json; charset=utf-8"},
+		{"application/xml", "application/problem+xml; charset=utf-8"},
+		{"text/xml;q=0.9, application/json;q=0.1", "application/problem+xml; charset=utf-8"},
+		{"", "application/problem+json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			RenderError(w, r, NewErrResponse(http.StatusNotFound, errors.New("no such gopher")))
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Fatalf("got Content-Type %q, want %q", ct, tt.wantType)
+			}
+			if w.Code != http.StatusNotFound {
+				t.Errorf("got status %d, want 404", w.Code)
+			}
+			if GetContentType(tt.wantType) == ContentTypeJSON {
+				if problem := decodeProblem(t, w); problem["title"] != "Not Found" || problem["detail"] != "no such gopher" {
+					t.Errorf("got %v", problem)
+				}
+				return
+			}
+
+			var problem struct {
+				XMLName xml.Name
+				Status  int    `xml:"status"`
+				Title   string `xml:"title"`
+				Detail  string `xml:"detail"`
+			}
+			if err := xml.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("invalid XML %q: %v", w.Body.String(), err)
+			}
+			want := xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}
+			if problem.XMLName != want || problem.Status != 404 || problem.Title != "Not Found" || problem.Detail != "no such gopher" {
+				t.Errorf("got %+v", problem)
+			}
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	errUnmapped := errors.New("unmapped")
+	tests := []struct {
+		name    string
+		mapping []ErrorMapping
+		err     error
+		want    int
+	}{
+		{"no rows", nil, sql.ErrNoRows, http.StatusNotFound},
+		{"wrapped no rows", nil, fmt.Errorf("load user: %w", sql.ErrNoRows), http.StatusNotFound},
+		{"deadline", nil, context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"canceled", nil, context.Canceled, StatusClientClosedRequest},
+		{"custom", []ErrorMapping{{errTestConflict, http.StatusConflict}}, errTestConflict, http.StatusConflict},
+		{"custom overrides default", []ErrorMapping{{sql.ErrNoRows, http.StatusGone}}, sql.ErrNoRows, http.StatusGone},
+		{"first match wins", []ErrorMapping{{errTestConflict, http.StatusConflict}, {sql.ErrNoRows, http.StatusGone}}, bothErrors{sql.ErrNoRows, errTestConflict}, http.StatusConflict},
+		{"unmapped", nil, errUnmapped, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got error
+			h := ErrorHandler(tt.mapping)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				SetHandlerError(r, tt.err)
+				got = GetHandlerError(r)
+			}))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got != tt.err {
+				t.Errorf("GetHandlerError returned %v, want %v", got, tt.err)
+			}
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerResponseWritten(t *testing.T) {
+	h := ErrorHandler(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetHandlerError(r, sql.ErrNoRows)
+		RespondStatus(w, r, http.StatusAccepted, M{"a": 1})
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want the handler's 202", w.Code)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"a":1}` {
+		t.Errorf("got %s, want the handler's response only", got)
+	}
+}
+
+func TestSetHandlerErrorOutsideErrorHandler(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	SetHandlerError(r, sql.ErrNoRows)
+	if err := GetHandlerError(r); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestStatusFromError(t *testing.T) {
+	errLocked := errors.New("locked")
+	RegisterErrorStatus(errTestConflict, http.StatusConflict)
+	defer unregisterErrorStatus(errTestConflict)
+	RegisterErrorStatus(errLocked, http.StatusLocked)
+	defer unregisterErrorStatus(errLocked)
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"deadline", context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"canceled", context.Canceled, StatusClientClosedRequest},
+		{"permission", os.ErrPermission, http.StatusForbidden},
+		{"not exist", os.ErrNotExist, http.StatusNotFound},
+		{"path error", &os.PathError{Op: "open", Path: "/x", Err: fs.ErrNotExist}, http.StatusNotFound},
+		{"custom", errTestConflict, http.StatusConflict},
+		{"wrapped", fmt.Errorf("save: %w", errTestConflict), http.StatusConflict},
+		{"first registered wins", bothErrors{errLocked, errTestConflict}, http.StatusConflict},
+		{"registered before default", bothErrors{os.ErrNotExist, errLocked}, http.StatusLocked},
+		{"default order", bothErrors{os.ErrNotExist, context.Canceled}, StatusClientClosedRequest},
+		{"unmapped", errors.New("db down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StatusFromError(tt.err); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderErrorStatusFromError(t *testing.T) {
+	w := httptest.NewRecorder()
+	RenderError(w, httptest.NewRequest("GET", "/", nil), fmt.Errorf("open: %w", os.ErrNotExist))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want 404", w.Code)
+	}
+}
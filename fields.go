@@ -0,0 +1,118 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+var (
+	// OmitFieldsCtxKey is a context key to record response fields to omit.
+	OmitFieldsCtxKey = &contextKey{"OmitFields"}
+
+	// IncludeFieldsCtxKey is a context key to record the only response fields
+	// to include.
+	IncludeFieldsCtxKey = &contextKey{"IncludeFields"}
+)
+
+// FieldFilter is a set of response fields to omit or include, see OmitFields
+// and IncludeOnlyFields.
+type FieldFilter struct {
+	Omit        []string
+	IncludeOnly []string
+}
+
+// FieldPolicy maps roles to the field filters applied by RoleBasedFields.
+var FieldPolicy = map[string]FieldFilter{}
+
+// OmitFields returns a shallow copy of r which has the given fields left out
+// of its JSON response. Fields are referred to by their JSON key, with nested
+// fields separated by dots, e.g. "user.internal_id".
+//
+// Filters are applied by the JSON encoders of this package only, e.g. JSON,
+// JSONC, GRPCWebJSON and event streams, so that while filters are set,
+// DefaultResponder responds with one of them whatever the Accept header, and
+// ignores the Codecs registered for them. Encoders such as XML or Form, when
+// called directly or set with WithEncoder, don't filter anything. Values
+// implementing json.Marshaler or encoding.TextMarshaler are encoded by their
+// own methods, hence as a whole: their fields can't be filtered.
+func OmitFields(r *http.Request, fields ...string) *http.Request {
+	fields = append(contextFields(r, OmitFieldsCtxKey), fields...)
+	return r.WithContext(context.WithValue(r.Context(), OmitFieldsCtxKey, fields))
+}
+
+// IncludeOnlyFields returns a shallow copy of r which only has the given
+// fields, and their parents, included in its JSON response. Fields are
+// referred to the same way as in OmitFields.
+func IncludeOnlyFields(r *http.Request, fields ...string) *http.Request {
+	fields = append(contextFields(r, IncludeFieldsCtxKey), fields...)
+	return r.WithContext(context.WithValue(r.Context(), IncludeFieldsCtxKey, fields))
+}
+
+// RoleBasedFields is a middleware that applies the FieldPolicy of the given
+// role to the JSON responses of the handler chain.
+func RoleBasedFields(role string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if policy, ok := FieldPolicy[role]; ok {
+				if len(policy.Omit) > 0 {
+					r = OmitFields(r, policy.Omit...)
+				}
+				if len(policy.IncludeOnly) > 0 {
+					r = IncludeOnlyFields(r, policy.IncludeOnly...)
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func contextFields(r *http.Request, key *contextKey) []string {
+	fields, _ := r.Context().Value(key).([]string)
+	// Copy, so that sibling requests don't share the backing array.
+	return append([]string(nil), fields...)
+}
+
+// fieldFilter decides which field paths are encoded in a response.
+type fieldFilter struct {
+	omit    []string
+	include []string
+}
+
+func getFieldFilter(r *http.Request) *fieldFilter {
+	omit, _ := r.Context().Value(OmitFieldsCtxKey).([]string)
+	include, _ := r.Context().Value(IncludeFieldsCtxKey).([]string)
+	if len(omit) == 0 && len(include) == 0 {
+		return nil
+	}
+	return &fieldFilter{omit: omit, include: include}
+}
+
+func (f *fieldFilter) keep(path string) bool {
+	if f == nil || path == "" {
+		return true
+	}
+	for _, p := range f.omit {
+		if path == p {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		// Keep included fields, their children and their parents.
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,172 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fieldsUser struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	InternalID string        `json:"internal_id"`
+	Profile    fieldsProfile `json:"profile"`
+}
+
+type fieldsProfile struct {
+	Bio       string `json:"bio"`
+	DebugInfo string `json:"debug_info"`
+}
+
+var testFieldsUser = fieldsUser{1, "gopher", "x-1", fieldsProfile{"hi", "dbg"}}
+
+func respondJSON(r *http.Request, v interface{}) string {
+	w := httptest.NewRecorder()
+	JSON(w, r, v)
+	return strings.TrimSpace(w.Body.String())
+}
+
+func TestOmitFields(t *testing.T) {
+	r := OmitFields(httptest.NewRequest("GET", "/", nil), "internal_id", "profile.debug_info")
+	want := `{"id":1,"name":"gopher","profile":{"bio":"hi"}}`
+	if got := respondJSON(r, testFieldsUser); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestIncludeOnlyFields(t *testing.T) {
+	r := IncludeOnlyFields(httptest.NewRequest("GET", "/", nil), "id", "profile.bio")
+	want := `{"id":1,"profile":{"bio":"hi"}}`
+	if got := respondJSON(r, testFieldsUser); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestOmitFieldsMap(t *testing.T) {
+	r := OmitFields(httptest.NewRequest("GET", "/", nil), "user.internal_id")
+	want := `{"user":{"id":1,"name":"gopher","profile":{"bio":"hi","debug_info":"dbg"}}}`
+	if got := respondJSON(r, M{"user": testFieldsUser}); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestOmitFieldsSiblingRequests(t *testing.T) {
+	base := OmitFields(httptest.NewRequest("GET", "/", nil), "id")
+	a := OmitFields(base, "name")
+	b := OmitFields(base, "profile")
+
+	if got, want := respondJSON(a, testFieldsUser), `{"internal_id":"x-1","profile":{"bio":"hi","debug_info":"dbg"}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := respondJSON(b, testFieldsUser), `{"name":"gopher","internal_id":"x-1"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRoleBasedFields(t *testing.T) {
+	defer func(policy map[string]FieldFilter) { FieldPolicy = policy }(FieldPolicy)
+	FieldPolicy = map[string]FieldFilter{
+		"public": {Omit: []string{"internal_id", "profile.debug_info"}},
+	}
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, r, testFieldsUser)
+	}
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"public", `{"id":1,"name":"gopher","profile":{"bio":"hi"}}`},
+		{"admin", `{"id":1,"name":"gopher","internal_id":"x-1","profile":{"bio":"hi","debug_info":"dbg"}}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		RoleBasedFields(tt.role)(http.HandlerFunc(h)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.role, got, tt.want)
+		}
+	}
+}
+
+// TestFieldFilterUntouched checks that filters don't change the encoding of
+// the fields they don't filter out.
+func TestFieldFilterUntouched(t *testing.T) {
+	for name, v := range jsonEquivalenceValues() {
+		t.Run(name, func(t *testing.T) {
+			want, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := OmitFields(httptest.NewRequest("GET", "/", nil), "nothing")
+			if got := respondJSON(r, v); got != string(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// TestFieldFilterContentTypes checks that filtered out fields don't leak
+// through content types other than JSON.
+func TestFieldFilterContentTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"xml", "application/xml", "application/json"},
+		{"form", "application/x-www-form-urlencoded", "application/json"},
+		{"grpc-web json", "application/grpc-web+json", "application/grpc-web+json"},
+		{"grpc-web proto", "application/grpc-web+proto", "application/json"},
+		{"jsonc", "application/x-jsonc", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, OmitFields(acceptRequest(tt.accept), "internal_id"), testFieldsUser)
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("got Content-Type %q, want %s", got, tt.want)
+			}
+			if strings.Contains(w.Body.String(), "x-1") {
+				t.Errorf("filtered out field leaked: %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestFieldFilterForcedContentType(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := OmitFields(WithContentType(acceptRequest("application/xml"), ContentTypeXML), "internal_id")
+	Respond(w, r, testFieldsUser)
+	if got, want := strings.TrimSpace(w.Body.String()), `{"id":1,"name":"gopher","profile":{"bio":"hi","debug_info":"dbg"}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFieldFilterCodec(t *testing.T) {
+	RegisterCodec(Codec{ContentType: ContentTypeJSON, Encoder: func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		b, _ := json.Marshal(v)
+		w.Write(b) //nolint:errcheck
+	}})
+	defer unregisterCodec(ContentTypeJSON)
+
+	w := httptest.NewRecorder()
+	Respond(w, OmitFields(acceptRequest("application/json"), "internal_id"), testFieldsUser)
+	if strings.Contains(w.Body.String(), "x-1") {
+		t.Errorf("filtered out field leaked: %q", w.Body.String())
+	}
+}
+
+func TestFieldFilterEventStream(t *testing.T) {
+	ch := make(chan fieldsUser, 1)
+	ch <- testFieldsUser
+	close(ch)
+
+	w := httptest.NewRecorder()
+	Respond(w, OmitFields(acceptRequest("text/event-stream"), "internal_id"), ch)
+	want := "event: data\ndata: {\"id\":1,\"name\":\"gopher\",\"profile\":{\"bio\":\"hi\",\"debug_info\":\"dbg\"}}\n\n"
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got %q, want %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,58 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// SendFile writes the file at path to the response, setting the Content-Type
+// as per its extension, defaulting to application/octet-stream. Files that
+// can't be opened, e.g. missing ones, are reported to OnError and responded to
+// with an ErrResponse of the status code of StatusFromError, e.g. 404 Not
+// Found, without exposing the path. Unlike http.ServeFile, it doesn't handle
+// range or conditional requests, but honors the status code hint, sending
+// neither the file nor its Content-Length for status codes without a body,
+// e.g. 304 Not Modified.
+func SendFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		reportError(r, fmt.Errorf("render: send file: %w", err))
+		RenderError(w, r, NewErrResponse(StatusFromError(err), nil))
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		err = fmt.Errorf("%s is a directory: %w", path, os.ErrNotExist)
+	}
+	if err != nil {
+		reportError(r, fmt.Errorf("render: send file: %w", err))
+		RenderError(w, r, NewErrResponse(StatusFromError(err), nil))
+		return
+	}
+
+	ct := mime.TypeByExtension(filepath.Ext(path))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	status, ok := r.Context().Value(StatusCtxKey).(int)
+	if ok && !bodyAllowed(status) {
+		// e.g. 304 Not Modified: the headers only, without the file.
+		applyHeaders(w, r)
+		writeHeader(w, r)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	if _, err := io.Copy(w, f); err != nil {
+		reportError(r, fmt.Errorf("render: send file: %w", err))
+	}
+}
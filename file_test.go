@@ -0,0 +1,89 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"a":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blob"), []byte{0, 1, 2}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		status     int
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{"exists", "data.json", 0, http.StatusOK, "application/json", `{"a":1}`},
+		{"unknown extension", "blob", 0, http.StatusOK, "application/octet-stream", "\x00\x01\x02"},
+		{"status hint", "data.json", http.StatusCreated, http.StatusCreated, "application/json", `{"a":1}`},
+		{"missing", "missing.json", 0, http.StatusNotFound, "application/problem+json; charset=utf-8", ""},
+		{"directory", ".", 0, http.StatusNotFound, "application/problem+json; charset=utf-8", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			defer captureErrors(&errs)()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.status != 0 {
+				Status(r, tt.status)
+			}
+			w := httptest.NewRecorder()
+			SendFile(w, r, filepath.Join(dir, tt.file))
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusNotFound {
+				if len(errs) != 1 || !errors.Is(errs[0], os.ErrNotExist) {
+					t.Errorf("got errors %v, want a not found error", errs)
+				}
+				if strings.Contains(w.Body.String(), dir) {
+					t.Errorf("path leaked: %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSendFileWithoutBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, []byte(`{"a":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotModified} {
+		r := httptest.NewRequest("GET", "/", nil)
+		Status(r, status)
+		w := httptest.NewRecorder()
+		SendFile(w, r, path)
+		if w.Code != status {
+			t.Errorf("got status %d, want %d", w.Code, status)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != "" {
+			t.Errorf("%d: got Content-Length %s", status, cl)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%d: got body %q", status, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// grpcHTTPStatus maps gRPC status codes to HTTP status codes, as per the
+// grpc-gateway mapping.
+var grpcHTTPStatus = map[uint64]int{
+	0:  http.StatusOK,                  // OK
+	1:  StatusClientClosedRequest,      // Canceled
+	2:  http.StatusInternalServerError, // Unknown
+	3:  http.StatusBadRequest,          // InvalidArgument
+	4:  http.StatusGatewayTimeout,      // DeadlineExceeded
+	5:  http.StatusNotFound,            // NotFound
+	6:  http.StatusConflict,            // AlreadyExists
+	7:  http.StatusForbidden,           // PermissionDenied
+	8:  http.StatusTooManyRequests,     // ResourceExhausted
+	9:  http.StatusBadRequest,          // FailedPrecondition
+	10: http.StatusConflict,            // Aborted
+	11: http.StatusBadRequest,          // OutOfRange
+	12: http.StatusNotImplemented,      // Unimplemented
+	13: http.StatusInternalServerError, // Internal
+	14: http.StatusServiceUnavailable,  // Unavailable
+	15: http.StatusInternalServerError, // DataLoss
+	16: http.StatusUnauthorized,        // Unauthenticated
+}
+
+// GRPCErrorRenderer returns an *ErrResponse for gRPC status errors, e.g. from
+// google.golang.org/grpc/status or gRPC-gateway, with the HTTP status code
+// mapped from the gRPC code and the status message as detail. It returns nil
+// if err, or any error it wraps, isn't a gRPC status error.
+//
+// gRPC status errors are recognized by their GRPCStatus method, so that this
+// package doesn't depend on gRPC. RenderError, and thus ErrorHandler, render
+// them this way too.
+func GRPCErrorRenderer(err error) Renderer {
+	if e := grpcErrResponse(err); e != nil {
+		return e
+	}
+	return nil
+}
+
+func grpcErrResponse(err error) *ErrResponse {
+	for ; err != nil; err = errors.Unwrap(err) {
+		code, msg, ok := grpcStatus(err)
+		if !ok {
+			continue
+		}
+		status, ok := grpcHTTPStatus[code]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		e := NewErrResponse(status, err)
+		e.Detail = msg
+		return e
+	}
+	return nil
+}
+
+// grpcStatus calls the GRPCStatus method of err, if any, returning the Code
+// and Message of the resulting *status.Status.
+func grpcStatus(err error) (code uint64, msg string, ok bool) {
+	m := reflect.ValueOf(err).MethodByName("GRPCStatus")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return 0, "", false
+	}
+	st := m.Call(nil)[0]
+	if st.Kind() == reflect.Ptr && st.IsNil() {
+		return 0, "", false
+	}
+	codeFn, msgFn := st.MethodByName("Code"), st.MethodByName("Message")
+	if !codeFn.IsValid() || !msgFn.IsValid() {
+		return 0, "", false
+	}
+	c, s := codeFn.Call(nil), msgFn.Call(nil)
+	if len(c) != 1 || len(s) != 1 || c[0].Kind() != reflect.Uint32 || s[0].Kind() != reflect.String {
+		return 0, "", false
+	}
+	return c[0].Uint(), s[0].String(), true
+}
@@ -0,0 +1,65 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// grpcCode and grpcTestStatus mimic codes.Code and *status.Status of
+// google.golang.org/grpc.
+type (
+	grpcCode       uint32
+	grpcTestStatus struct {
+		code grpcCode
+		msg  string
+	}
+	grpcTestError struct{ st *grpcTestStatus }
+)
+
+func (s *grpcTestStatus) Code() grpcCode            { return s.code }
+func (s *grpcTestStatus) Message() string           { return s.msg }
+func (e grpcTestError) Error() string               { return "rpc error: " + e.st.msg }
+func (e grpcTestError) GRPCStatus() *grpcTestStatus { return e.st }
+
+func TestGRPCErrorRenderer(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", grpcTestError{&grpcTestStatus{5, "no such gopher"}}, http.StatusNotFound},
+		{"wrapped", fmt.Errorf("get: %w", grpcTestError{&grpcTestStatus{16, "no token"}}), http.StatusUnauthorized},
+		{"unknown code", grpcTestError{&grpcTestStatus{42, "what"}}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := GRPCErrorRenderer(tt.err).(*ErrResponse)
+			if !ok {
+				t.Fatalf("got %T, want an *ErrResponse", GRPCErrorRenderer(tt.err))
+			}
+			if e.Status != tt.want {
+				t.Errorf("got status %d, want %d", e.Status, tt.want)
+			}
+		})
+	}
+
+	for _, err := range []error{errors.New("plain"), grpcTestError{nil}} {
+		if v := GRPCErrorRenderer(err); v != nil {
+			t.Errorf("%v: got %v, want nil", err, v)
+		}
+	}
+}
+
+func TestRenderErrorGRPC(t *testing.T) {
+	w := httptest.NewRecorder()
+	RenderError(w, httptest.NewRequest("GET", "/", nil), grpcTestError{&grpcTestStatus{5, "no such gopher"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want 404", w.Code)
+	}
+	if got := decodeProblem(t, w)["detail"]; got != "no such gopher" {
+		t.Errorf("got detail %v, want the gRPC message", got)
+	}
+}
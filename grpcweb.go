@@ -0,0 +1,186 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// gRPC-web frame flags, see
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+const (
+	grpcWebDataFrame    byte = 0x00
+	grpcWebTrailerFrame byte = 0x80
+	grpcWebCompressed   byte = 0x01
+)
+
+// GRPCWebMaxMessageSize is the maximum size, in bytes, of the messages of
+// gRPC-web request bodies, 4 MiB by default like gRPC servers. Larger ones
+// are rejected by DecodeGRPCWebJSON and DecodeGRPCWebProto.
+var GRPCWebMaxMessageSize int64 = 4 << 20
+
+// GRPCStatusCtxKey is a context key to record the gRPC status of gRPC-web
+// responses.
+var GRPCStatusCtxKey = &contextKey{"GRPCStatus"}
+
+type grpcStatusValue struct {
+	code    int
+	message string
+}
+
+// GRPCStatus sets the gRPC status code and message sent in the trailers of
+// gRPC-web responses, which default to 0 (OK). As browsers can't read HTTP
+// trailers, gRPC-web sends them in a trailer frame at the end of the body.
+func GRPCStatus(r *http.Request, code int, message string) {
+	*r = *r.WithContext(context.WithValue(r.Context(), GRPCStatusCtxKey, grpcStatusValue{code, message}))
+}
+
+// GRPCWebJSON writes 'v' as JSON in a gRPC-web data frame, followed by the
+// trailer frame, setting the Content-Type as application/grpc-web+json.
+func GRPCWebJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := encodeGRPCWebJSON(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+func encodeGRPCWebJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := marshalJSON(buf, v, getFieldFilter(r)); err != nil {
+		return err
+	}
+	writeGRPCWeb(w, r, "application/grpc-web+json", bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return nil
+}
+
+// GRPCWebProto writes 'v', a marshalled protobuf message, in a gRPC-web data
+// frame, followed by the trailer frame, setting the Content-Type as
+// application/grpc-web+proto. 'v' is either the message bytes or a message
+// with a Marshal() ([]byte, error) method, as this package doesn't depend on
+// protobuf.
+func GRPCWebProto(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := encodeGRPCWebProto(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+func encodeGRPCWebProto(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	var b []byte
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case interface{ Marshal() ([]byte, error) }:
+		var err error
+		if b, err = v.Marshal(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("render: cannot encode %T as protobuf", v)
+	}
+	writeGRPCWeb(w, r, "application/grpc-web+proto", b)
+	return nil
+}
+
+func writeGRPCWeb(w http.ResponseWriter, r *http.Request, mediaType string, b []byte) {
+	st, _ := r.Context().Value(GRPCStatusCtxKey).(grpcStatusValue)
+	trailers := "grpc-status:" + strconv.Itoa(st.code) + "\r\n"
+	if st.message != "" {
+		trailers += "grpc-message:" + grpcPercentEncode(st.message) + "\r\n"
+	}
+
+	buf := &bytes.Buffer{}
+	writeGRPCWebFrame(buf, grpcWebDataFrame, b)
+	writeGRPCWebFrame(buf, grpcWebTrailerFrame, []byte(trailers))
+
+	w.Header().Set("Content-Type", mediaType)
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(buf.Bytes()) //nolint:errcheck
+}
+
+// writeGRPCWebFrame writes a frame: a flag byte, the big-endian length of
+// the payload on 4 bytes, and the payload.
+func writeGRPCWebFrame(buf *bytes.Buffer, flag byte, payload []byte) {
+	var header [5]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	buf.Write(header[:])
+	buf.Write(payload)
+}
+
+// grpcPercentEncode percent-encodes a grpc-message, as per the gRPC spec.
+func grpcPercentEncode(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// DecodeGRPCWebJSON decodes the JSON message of a gRPC-web request body into
+// an interface.
+func DecodeGRPCWebJSON(r io.Reader, v interface{}) error {
+	b, err := readGRPCWebFrame(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// DecodeGRPCWebProto decodes the protobuf message of a gRPC-web request body
+// into 'v', either a *[]byte receiving the message bytes or a message with an
+// Unmarshal([]byte) error method.
+func DecodeGRPCWebProto(r io.Reader, v interface{}) error {
+	b, err := readGRPCWebFrame(r)
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case *[]byte:
+		*v = b
+		return nil
+	case interface{ Unmarshal([]byte) error }:
+		return v.Unmarshal(b)
+	default:
+		return fmt.Errorf("render: cannot decode protobuf into %T", v)
+	}
+}
+
+// readGRPCWebFrame reads the payload of the first, uncompressed, data frame.
+func readGRPCWebFrame(r io.Reader) ([]byte, error) {
+	defer io.Copy(io.Discard, r) //nolint:errcheck
+
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("render: grpc-web frame header: %w", err)
+	}
+	if header[0]&grpcWebTrailerFrame != 0 {
+		return nil, errors.New("render: grpc-web request without data frame")
+	}
+	if header[0]&grpcWebCompressed != 0 {
+		return nil, errors.New("render: compressed grpc-web frames are not supported")
+	}
+	n := int64(binary.BigEndian.Uint32(header[1:]))
+	if n > GRPCWebMaxMessageSize {
+		return nil, fmt.Errorf("render: grpc-web message of %d bytes exceeds the maximum of %d bytes", n, GRPCWebMaxMessageSize)
+	}
+	// Read rather than allocate the length announced by the client.
+	b, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, fmt.Errorf("render: grpc-web frame: %w", err)
+	}
+	if int64(len(b)) != n {
+		return nil, fmt.Errorf("render: grpc-web frame: %w", io.ErrUnexpectedEOF)
+	}
+	return b, nil
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// grpcWebFrames splits a gRPC-web body into its frames.
+func grpcWebFrames(t *testing.T, body []byte) (flags []byte, payloads []string) {
+	t.Helper()
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated frame header %x", body)
+		}
+		n := int(binary.BigEndian.Uint32(body[1:5]))
+		if len(body) < 5+n {
+			t.Fatalf("truncated frame of %d bytes", n)
+		}
+		flags = append(flags, body[0])
+		payloads = append(payloads, string(body[5:5+n]))
+		body = body[5+n:]
+	}
+	return flags, payloads
+}
+
+type protoMessage struct{ b []byte }
+
+func (m protoMessage) Marshal() ([]byte, error) { return m.b, nil }
+
+func TestGRPCWebJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	GRPCStatus(r, 5, "not found: 100%")
+	GRPCWebJSON(w, r, M{"name": "gopher"})
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/grpc-web+json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	body := w.Body.Bytes()
+	if want := []byte{0, 0, 0, 0, 17}; !bytes.Equal(body[:5], want) {
+		t.Errorf("got frame header %x, want %x", body[:5], want)
+	}
+	flags, payloads := grpcWebFrames(t, body)
+	if len(flags) != 2 || flags[0] != 0x00 || flags[1] != 0x80 {
+		t.Fatalf("got frame flags %x, want a data and a trailer frame", flags)
+	}
+	if payloads[0] != `{"name":"gopher"}` {
+		t.Errorf("got payload %q", payloads[0])
+	}
+	if want := "grpc-status:5\r\ngrpc-message:not found: 100%25\r\n"; payloads[1] != want {
+		t.Errorf("got trailers %q, want %q", payloads[1], want)
+	}
+}
+
+func TestGRPCWebProto(t *testing.T) {
+	for _, v := range []interface{}{[]byte{0x08, 0x96, 0x01}, protoMessage{[]byte{0x08, 0x96, 0x01}}} {
+		w := httptest.NewRecorder()
+		GRPCWebProto(w, httptest.NewRequest("POST", "/", nil), v)
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/grpc-web+proto" {
+			t.Errorf("got Content-Type %q", ct)
+		}
+		_, payloads := grpcWebFrames(t, w.Body.Bytes())
+		if len(payloads) != 2 || payloads[0] != "\x08\x96\x01" || payloads[1] != "grpc-status:0\r\n" {
+			t.Errorf("got frames %q", payloads)
+		}
+	}
+}
+
+func TestGRPCWebProtoUnsupported(t *testing.T) {
+	var calls int
+	defer countSuccess(&calls)()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Accept", "application/grpc-web+proto")
+	Respond(w, r, M{"name": "gopher"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", w.Code)
+	}
+	if calls != 0 {
+		t.Errorf("OnSuccess called %d times after an encoding error", calls)
+	}
+}
+
+func grpcWebBody(flag byte, payload string) io.Reader {
+	buf := &bytes.Buffer{}
+	writeGRPCWebFrame(buf, flag, []byte(payload))
+	return buf
+}
+
+func TestDecodeGRPCWeb(t *testing.T) {
+	var p namedPayload
+	if err := DecodeGRPCWebJSON(grpcWebBody(0, `{"name":"gopher"}`), &p); err != nil || p.Name != "gopher" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	var b []byte
+	if err := DecodeGRPCWebProto(grpcWebBody(0, "\x08\x96\x01"), &b); err != nil || string(b) != "\x08\x96\x01" {
+		t.Errorf("got %x, %v", b, err)
+	}
+}
+
+func TestDecodeGRPCWebErrors(t *testing.T) {
+	var v interface{}
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{"empty", strings.NewReader("")},
+		{"trailer only", grpcWebBody(0x80, "grpc-status:0\r\n")},
+		{"compressed", grpcWebBody(0x01, "{}")},
+		{"truncated", strings.NewReader("\x00\x00\x00\x00\x10{}")},
+		{"oversized", strings.NewReader("\x00\xff\xff\xff\xff")},
+	}
+	for _, tt := range tests {
+		if err := DecodeGRPCWebJSON(tt.body, &v); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDecodeGRPCWebMaxMessageSize(t *testing.T) {
+	defer func(size int64) { GRPCWebMaxMessageSize = size }(GRPCWebMaxMessageSize)
+	GRPCWebMaxMessageSize = 4
+
+	var b []byte
+	if err := DecodeGRPCWebProto(grpcWebBody(0, "12345"), &b); err == nil {
+		t.Error("expected an error for a message over the maximum size")
+	}
+	if err := DecodeGRPCWebProto(grpcWebBody(0, "1234"), &b); err != nil {
+		t.Errorf("got %v for a message of the maximum size", err)
+	}
+}
@@ -0,0 +1,118 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyTTL is how long the IdempotencyKey middleware keeps
+// responses around for replay.
+var IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKeyScope, if set, returns the scope of the Idempotency-Key of
+// a request for the IdempotencyKey middleware, typically the authenticated
+// subject, e.g. the user ID set in the request context by an authentication
+// middleware, so that clients can't replay the responses to each other.
+var IdempotencyKeyScope func(r *http.Request) string
+
+// ErrIdempotencyKeyInUse is the error of the 409 Conflict response of the
+// IdempotencyKey middleware to requests with a key still being processed.
+var ErrIdempotencyKeyInUse = errors.New("render: a request with the same Idempotency-Key is being processed")
+
+// IdempotencyStore stores responses for the IdempotencyKey middleware.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// CachedResponse is a response recorded for later replay.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// writeTo replays the response to w.
+func (c *CachedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range c.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(c.Status)
+	w.Write(c.Body) //nolint:errcheck
+}
+
+// IdempotencyKey is a middleware making POST and PATCH requests carrying an
+// Idempotency-Key header safe to retry: the response to the first request
+// with a given key is recorded in store and replayed for subsequent requests
+// with the same key, without calling the next handler. Keys are scoped by
+// request method and path, and by IdempotencyKeyScope. Server errors (5xx)
+// are not recorded, so that they can be retried. Requests without the header
+// pass through.
+//
+// Without IdempotencyKeyScope, any client sending a key another client used
+// gets the response recorded for the latter, body included: set it, or use
+// a store scoped by client, unless all the clients are trusted alike.
+//
+// Retries arriving while the request with the same key is still being
+// processed get a 409 Conflict response. That guard is local to the
+// middleware, so it doesn't span processes sharing a store.
+func IdempotencyKey(store IdempotencyStore) func(next http.Handler) http.Handler {
+	var (
+		mu       sync.Mutex
+		inFlight = map[string]bool{}
+	)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = r.Method + " " + r.URL.Path + " " + key
+			if IdempotencyKeyScope != nil {
+				key = IdempotencyKeyScope(r) + " " + key
+			}
+
+			if resp, ok := store.Get(key); ok {
+				resp.writeTo(w)
+				return
+			}
+
+			mu.Lock()
+			reserved := !inFlight[key]
+			inFlight[key] = true
+			mu.Unlock()
+			if !reserved {
+				RenderError(w, r, NewErrResponse(http.StatusConflict, ErrIdempotencyKeyInUse))
+				return
+			}
+			defer func() {
+				mu.Lock()
+				delete(inFlight, key)
+				mu.Unlock()
+			}()
+
+			// The request holding the key may have completed in between.
+			if resp, ok := store.Get(key); ok {
+				resp.writeTo(w)
+				return
+			}
+
+			bw := newBufferWriter()
+			next.ServeHTTP(bw, r)
+			resp := &CachedResponse{
+				Status: bw.Status(),
+				Header: bw.Header().Clone(),
+				Body:   append([]byte(nil), bw.body.Bytes()...),
+			}
+			if resp.Status < 500 {
+				store.Set(key, resp, IdempotencyKeyTTL)
+			}
+			resp.writeTo(w)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
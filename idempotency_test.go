@@ -0,0 +1,181 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memIdempotencyStore struct {
+	mu    sync.Mutex
+	resps map[string]*CachedResponse
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{resps: map[string]*CachedResponse{}}
+}
+
+func (s *memIdempotencyStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.resps[key]
+	return resp, ok
+}
+
+func (s *memIdempotencyStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resps[key] = resp
+}
+
+// countingHandler responds with the number of times it has been called.
+func countingHandler(status int) (http.Handler, *int) {
+	calls := new(int)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		RespondStatus(w, r, status, M{"calls": *calls})
+	}), calls
+}
+
+func idempotentRequest(method, path, key string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	return r
+}
+
+func TestIdempotencyKeyReplay(t *testing.T) {
+	store := newMemIdempotencyStore()
+	h, calls := countingHandler(http.StatusCreated)
+	h = IdempotencyKey(store)(h)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, idempotentRequest("POST", "/orders", "k1"))
+		if w.Code != http.StatusCreated || w.Body.String() != "{\"calls\":1}\n" {
+			t.Errorf("request %d: got %d %q, want the first response", i, w.Code, w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("request %d: got Content-Type %q", i, ct)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("handler called %d times, want 1", *calls)
+	}
+	if len(store.resps) != 1 {
+		t.Errorf("got %d stored responses, want 1", len(store.resps))
+	}
+}
+
+func TestIdempotencyKeyPassThrough(t *testing.T) {
+	store := newMemIdempotencyStore()
+	h, calls := countingHandler(http.StatusOK)
+	h = IdempotencyKey(store)(h)
+
+	for _, r := range []*http.Request{
+		idempotentRequest("POST", "/orders", ""),
+		idempotentRequest("POST", "/orders", ""),
+		idempotentRequest("GET", "/orders", "k1"),
+		idempotentRequest("GET", "/orders", "k1"),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if *calls != 4 {
+		t.Errorf("handler called %d times, want 4", *calls)
+	}
+	if len(store.resps) != 0 {
+		t.Errorf("got %d stored responses, want none", len(store.resps))
+	}
+}
+
+func TestIdempotencyKeyScope(t *testing.T) {
+	h, calls := countingHandler(http.StatusOK)
+	h = IdempotencyKey(newMemIdempotencyStore())(h)
+
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "k1"))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/payments", "k1"))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("PATCH", "/orders", "k1"))
+	if *calls != 3 {
+		t.Errorf("handler called %d times, want 3: keys must be scoped by method and path", *calls)
+	}
+}
+
+func TestIdempotencyKeyScopeFunc(t *testing.T) {
+	defer func(scope func(*http.Request) string) { IdempotencyKeyScope = scope }(IdempotencyKeyScope)
+	IdempotencyKeyScope = func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}
+
+	h, calls := countingHandler(http.StatusOK)
+	h = IdempotencyKey(newMemIdempotencyStore())(h)
+	request := func(user string) *httptest.ResponseRecorder {
+		r := idempotentRequest("POST", "/orders", "k1")
+		r.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	request("alice")
+	if w := request("mallory"); w.Body.String() != "{\"calls\":2}\n" {
+		t.Errorf("got %s: the response to another client was replayed", w.Body.String())
+	}
+	if w := request("alice"); w.Body.String() != "{\"calls\":1}\n" {
+		t.Errorf("got %s, want the replayed response", w.Body.String())
+	}
+	if *calls != 2 {
+		t.Errorf("handler called %d times, want 2", *calls)
+	}
+}
+
+func TestIdempotencyKeyServerError(t *testing.T) {
+	store := newMemIdempotencyStore()
+	h, calls := countingHandler(http.StatusServiceUnavailable)
+	h = IdempotencyKey(store)(h)
+
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "k1"))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "k1"))
+	if *calls != 2 {
+		t.Errorf("handler called %d times, want 2", *calls)
+	}
+}
+
+func TestIdempotencyKeyInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	h := IdempotencyKey(newMemIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		close(started)
+		<-release
+		JSON(w, r, M{"ok": true})
+	}))
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(first, idempotentRequest("POST", "/orders", "k1"))
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, idempotentRequest("POST", "/orders", "k1"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("concurrent retry: got status %d, want 409", w.Code)
+	}
+
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, idempotentRequest("POST", "/orders", "k1"))
+	if w.Code != http.StatusOK || w.Body.String() != first.Body.String() {
+		t.Errorf("retry: got %d %q, want the replayed first response", w.Code, w.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,155 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// JSONC writes a JSON with comments document, e.g. a configuration file, as
+// standard JSON: comments and trailing commas are stripped from 'v' when it's
+// a string, []byte or json.RawMessage. Any other value is encoded as per JSON.
+func JSONC(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := encodeJSONC(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+func encodeJSONC(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = []byte(v)
+	case json.RawMessage:
+		b = v
+	case []byte:
+		b = v
+	default:
+		return encodeJSON(w, r, v)
+	}
+	return encodeJSON(w, r, json.RawMessage(stripTrailingCommas(stripJSONComments(b))))
+}
+
+// DecodeJSONC decodes a given reader of JSON with comments into an interface
+// using the json decoder, after stripping comments and trailing commas.
+func DecodeJSONC(r io.Reader, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(stripTrailingCommas(stripJSONComments(b)), v)
+}
+
+// DecodeJSONLenient decodes a given reader into an interface using the json
+// decoder, after stripping trailing commas of objects and arrays, e.g.
+// `{"tags": ["a", "b",],}`. Other syntax errors are reported as usual.
+func DecodeJSONLenient(r io.Reader, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(stripTrailingCommas(b), v)
+}
+
+// LenientJSON is a middleware decoding JSON request bodies with
+// DecodeJSONLenient, e.g. for developer facing endpoints. Requests of other
+// content types are left alone.
+func LenientJSON() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if RequestContentType(r) == ContentTypeJSON {
+				r = WithDecoder(r, DecodeJSONLenient)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// stripJSONComments removes // and /* */ comments outside of JSON strings,
+// keeping line breaks so that error offsets still point to the same lines.
+func stripJSONComments(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '"':
+			end := skipJSONString(b, i)
+			out = append(out, b[i:end]...)
+			i = end - 1
+
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '/':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+			if i < len(b) {
+				out = append(out, '\n')
+			}
+
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := bytes.Index(b[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(b)
+			} else {
+				end += i + 4
+			}
+			for _, c := range b[i:end] {
+				if c == '\n' {
+					out = append(out, '\n')
+				}
+			}
+			out = append(out, ' ')
+			i = end - 1
+
+		default:
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+// stripTrailingCommas removes commas directly preceding the closing token of
+// an object or array, outside of JSON strings.
+func stripTrailingCommas(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '"':
+			end := skipJSONString(b, i)
+			out = append(out, b[i:end]...)
+			i = end - 1
+
+		case ',':
+			j := i + 1
+			for j < len(b) && isJSONSpace(b[j]) {
+				j++
+			}
+			if j < len(b) && (b[j] == '}' || b[j] == ']') {
+				continue
+			}
+			out = append(out, b[i])
+
+		default:
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+// skipJSONString returns the index right after the JSON string starting at
+// b[start], or len(b) if it's unterminated.
+func skipJSONString(b []byte, start int) int {
+	for i := start + 1; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(b)
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
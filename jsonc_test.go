@@ -0,0 +1,202 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"none", `{"a": 1}`, `{"a": 1}`},
+		{"line", "{\"a\": 1 // one\n}", "{\"a\": 1 \n}"},
+		{"line at end", "{\"a\": 1} // one", "{\"a\": 1} "},
+		{"block", `{/* a */"a": 1}`, `{ "a": 1}`},
+		{"multiline block", "{/* a\nb */\"a\": 1}", "{\n \"a\": 1}"},
+		{"unterminated block", `{"a": 1} /* a`, `{"a": 1}  `},
+		{"in string", `{"url": "http://example.com/*x*/"}`, `{"url": "http://example.com/*x*/"}`},
+		{"escaped quote", `{"a": "\"//"} // c`, `{"a": "\"//"} `},
+		{"slash", `{"a": "/"} /`, `{"a": "/"} /`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripJSONComments([]byte(tt.in))); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTrailingCommas(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"object", `{"a": 1,}`, `{"a": 1}`},
+		{"array", "[1, 2,\n]", "[1, 2\n]"},
+		{"nested", `{"a": [1,], "b": {"c": 2,},}`, `{"a": [1], "b": {"c": 2}}`},
+		{"in string", `{"a": ",}",}`, `{"a": ",}"}`},
+		{"not trailing", `[1, 2]`, `[1, 2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripTrailingCommas([]byte(tt.in))); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+const jsoncDocument = `{
+	// The server name.
+	"name": "gopher", /* inline */
+	"url": "https://example.com//path",
+	"tags": [
+		"a",
+		"b", // trailing comma
+	],
+}`
+
+func TestDecodeJSONC(t *testing.T) {
+	var v struct {
+		Name string   `json:"name"`
+		URL  string   `json:"url"`
+		Tags []string `json:"tags"`
+	}
+	if err := DecodeJSONC(strings.NewReader(jsoncDocument), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "gopher" || v.URL != "https://example.com//path" || strings.Join(v.Tags, ",") != "a,b" {
+		t.Errorf("got %+v", v)
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(jsoncDocument))
+	r.Header.Set("Content-Type", "application/x-jsonc")
+	var m map[string]interface{}
+	if err := DefaultDecoder(r, &m); err != nil || m["name"] != "gopher" {
+		t.Errorf("DefaultDecoder: got %v, %v", m, err)
+	}
+}
+
+func TestDecodeJSONCSyntaxErrorLine(t *testing.T) {
+	err := DecodeJSONC(strings.NewReader("{\n// comment\n\"a\": 1,\n\"b\" 2\n}"), &struct{}{})
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("got %v, want a *json.SyntaxError", err)
+	}
+	// Comments are replaced with line breaks, so the offset stays on the
+	// same line as in the original document.
+	in := "{\n\n\"a\": 1,\n\"b\" 2\n}"
+	if line := strings.Count(in[:syntaxErr.Offset], "\n") + 1; line != 4 {
+		t.Errorf("got error on line %d, want 4", line)
+	}
+}
+
+func TestJSONC(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"string", jsoncDocument, `{"name":"gopher","url":"https://example.com//path","tags":["a","b"]}`},
+		{"bytes", []byte(jsoncDocument), `{"name":"gopher","url":"https://example.com//path","tags":["a","b"]}`},
+		{"raw message", json.RawMessage(`[1, /* two */ 2,]`), `[1,2]`},
+		{"value", M{"a": "// not a comment"}, `{"a":"// not a comment"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			JSONC(w, httptest.NewRequest("GET", "/", nil), tt.v)
+			got := &bytes.Buffer{}
+			if err := json.Compact(got, w.Body.Bytes()); err != nil {
+				t.Fatalf("got invalid JSON %q: %v", w.Body.String(), err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("got Content-Type %q", ct)
+			}
+		})
+	}
+}
+
+func TestJSONCNegotiated(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/x-jsonc")
+	w := httptest.NewRecorder()
+	Respond(w, r, jsoncDocument)
+	var v map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil || v["name"] != "gopher" {
+		t.Errorf("got %q, %v", w.Body.String(), err)
+	}
+}
+
+func TestJSONCInvalid(t *testing.T) {
+	w := httptest.NewRecorder()
+	JSONC(w, httptest.NewRequest("GET", "/", nil), `{"a": /* unterminated`)
+	if w.Code != 500 {
+		t.Errorf("got status %d, want 500", w.Code)
+	}
+}
+
+func TestDecodeJSONLenient(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"object", `{"a": 1,}`, `{"a":1}`},
+		{"array", `{"a": [1, 2,]}`, `{"a":[1,2]}`},
+		{"nested", `{"a": {"b": [1,],},}`, `{"a":{"b":[1]}}`},
+		{"multiple levels", `[[[1,],[2,],],{"c": [{"d": 3,},],},]`, `[[[1],[2]],{"c":[{"d":3}]}]`},
+		{"valid", `{"a": ",]", "b": [1, 2]}`, `{"a":",]","b":[1,2]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := DecodeJSONLenient(strings.NewReader(tt.in), &v); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(v)
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	var v interface{}
+	if err := DecodeJSONLenient(strings.NewReader(`{"a": 1 // one
+}`), &v); err == nil {
+		t.Error("got no error for a comment")
+	}
+}
+
+func TestLenientJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"name": "gopher",}`},
+		{"other content type", "application/x-www-form-urlencoded", "name=gopher"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p namedPayload
+			var err error
+			h := LenientJSON()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err = Bind(r, &p)
+			}))
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if err != nil || p.Name != "gopher" {
+				t.Errorf("got %+v, %v", p, err)
+			}
+		})
+	}
+}
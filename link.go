@@ -0,0 +1,93 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// LinkHeaderCtxKey is a context key to record the Link header of a response.
+var LinkHeaderCtxKey = &contextKey{"LinkHeader"}
+
+// LinkHeader is a builder for the Link header (RFC 8288), used for
+// pagination and related resources.
+type LinkHeader struct {
+	links []link
+}
+
+type link struct {
+	url string
+	rel string
+}
+
+// Add adds a link to url with the given relation type, e.g. "next".
+func (lh *LinkHeader) Add(url, rel string) *LinkHeader {
+	lh.links = append(lh.links, link{url: url, rel: rel})
+	return lh
+}
+
+// String formats the links as a Link header value, e.g.
+// `<https://api.example.com/items?page=2>; rel="next"`.
+func (lh *LinkHeader) String() string {
+	parts := make([]string, 0, len(lh.links))
+	for _, l := range lh.links {
+		target := l.url
+		if u, err := url.Parse(l.url); err == nil {
+			target = u.String()
+		} else {
+			target = url.PathEscape(l.url)
+		}
+		parts = append(parts, "<"+target+`>; rel="`+strings.ReplaceAll(l.rel, `"`, `\"`)+`"`)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetLinkHeader returns a shallow copy of r with lh set as the Link header of
+// its response. The header is written by the responders.
+func SetLinkHeader(r *http.Request, lh *LinkHeader) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), LinkHeaderCtxKey, lh))
+}
+
+// Paginate returns a LinkHeader with the "first", "prev", "next" and "last"
+// links of a paginated collection of total items, pageSize items per page,
+// with current being the current page number, starting at 1. Links point to
+// baseURL with the "page" query parameter set. The "prev" and "next" links
+// are left out on the first and last pages respectively.
+func Paginate(current, total, pageSize int, baseURL string) *LinkHeader {
+	last := 1
+	if pageSize > 0 && total > 0 {
+		last = (total + pageSize - 1) / pageSize
+	}
+
+	pageURL := func(page int) string {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return baseURL
+		}
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	lh := &LinkHeader{}
+	lh.Add(pageURL(1), "first")
+	if current > 1 {
+		lh.Add(pageURL(current-1), "prev")
+	}
+	if current < last {
+		lh.Add(pageURL(current+1), "next")
+	}
+	lh.Add(pageURL(last), "last")
+	return lh
+}
+
+// applyLinkHeader sets the Link header recorded in the request context on
+// the response.
+func applyLinkHeader(w http.ResponseWriter, r *http.Request) {
+	if lh, ok := r.Context().Value(LinkHeaderCtxKey).(*LinkHeader); ok && len(lh.links) > 0 {
+		w.Header().Set("Link", lh.String())
+	}
+}
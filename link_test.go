@@ -0,0 +1,50 @@
+package render
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLinkHeader(t *testing.T) {
+	lh := (&LinkHeader{}).
+		Add("https://api.example.com/items?page=2", "next").
+		Add("https://api.example.com/items?page=1", "prev").
+		Add("/a b", `related"`)
+	want := `<https://api.example.com/items?page=2>; rel="next", ` +
+		`<https://api.example.com/items?page=1>; rel="prev", ` +
+		`</a%20b>; rel="related\""`
+	if got := lh.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		want    string
+	}{
+		{"first", 1, `</items?page=1&q=x>; rel="first", </items?page=2&q=x>; rel="next", </items?page=3&q=x>; rel="last"`},
+		{"middle", 2, `</items?page=1&q=x>; rel="first", </items?page=1&q=x>; rel="prev", </items?page=3&q=x>; rel="next", </items?page=3&q=x>; rel="last"`},
+		{"last", 3, `</items?page=1&q=x>; rel="first", </items?page=2&q=x>; rel="prev", </items?page=3&q=x>; rel="last"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Paginate(tt.current, 25, 10, "/items?q=x&page=9").String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	r := SetLinkHeader(httptest.NewRequest("GET", "/", nil), Paginate(1, 0, 10, "/items"))
+	w := httptest.NewRecorder()
+	JSON(w, r, M{"items": []int{}})
+
+	// The recorder snapshots the header on WriteHeader.
+	want := `</items?page=1>; rel="first", </items?page=1>; rel="last"`
+	if got := w.Result().Header.Get("Link"); got != want {
+		t.Errorf("got Link %q, want %q", got, want)
+	}
+}
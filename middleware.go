@@ -0,0 +1,140 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SecureHeadersOptions configures the SecureHeaders middleware. Each field
+// holds the value of the corresponding response header; an empty value
+// disables the header.
+type SecureHeadersOptions struct {
+	// ContentTypeOptions is the X-Content-Type-Options header, e.g. "nosniff".
+	ContentTypeOptions string
+
+	// FrameOptions is the X-Frame-Options header, e.g. "DENY" or "SAMEORIGIN".
+	FrameOptions string
+
+	// XSSProtection is the X-XSS-Protection header. Modern browsers ignore
+	// it, and "0" is recommended to disable the legacy XSS auditor.
+	XSSProtection string
+
+	// ReferrerPolicy is the Referrer-Policy header, e.g. "no-referrer".
+	ReferrerPolicy string
+}
+
+// DefaultSecureHeadersOptions is a sensible set of security headers for APIs.
+var DefaultSecureHeadersOptions = SecureHeadersOptions{
+	ContentTypeOptions: "nosniff",
+	FrameOptions:       "DENY",
+	XSSProtection:      "0",
+	ReferrerPolicy:     "strict-origin-when-cross-origin",
+}
+
+// SecureHeaders is a middleware that sets common security headers on every
+// response, as configured by opts.
+func SecureHeaders(opts SecureHeadersOptions) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			if opts.ContentTypeOptions != "" {
+				h.Set("X-Content-Type-Options", opts.ContentTypeOptions)
+			}
+			if opts.FrameOptions != "" {
+				h.Set("X-Frame-Options", opts.FrameOptions)
+			}
+			if opts.XSSProtection != "" {
+				h.Set("X-XSS-Protection", opts.XSSProtection)
+			}
+			if opts.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", opts.ReferrerPolicy)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// NoSniff is a middleware that sets "X-Content-Type-Options: nosniff" on
+// every response, so that browsers don't try to guess the content type.
+func NoSniff(next http.Handler) http.Handler {
+	return SecureHeaders(SecureHeadersOptions{ContentTypeOptions: "nosniff"})(next)
+}
+
+// MaxHeaderSize is a middleware that rejects requests with headers larger
+// than maxBytes in total with a 431 Request Header Fields Too Large response.
+// The size accounts for the request line and each header field line as sent
+// on the wire, including the Host header and CRLF delimiters, so that large
+// cookies are counted in full.
+func MaxHeaderSize(maxBytes int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if headerSize(r) > maxBytes {
+				RenderError(w, r, NewErrResponse(http.StatusRequestHeaderFieldsTooLarge, nil))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// headerSize returns the size of the request line and header fields of r.
+func headerSize(r *http.Request) int {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	size := len(r.Method) + 1 + len(uri) + 1 + len(r.Proto) + 2
+	if r.Host != "" {
+		size += len("Host: ") + len(r.Host) + 2
+	}
+	for k, values := range r.Header {
+		for _, v := range values {
+			size += len(k) + len(": ") + len(v) + 2
+		}
+	}
+	return size
+}
+
+// RequestTimeout is a middleware that cancels the request context after d
+// and, if the handler hasn't returned by then, responds with a 503 Service
+// Unavailable ErrResponse. The handler response is buffered until it returns,
+// so that late writes can't interfere with the timeout response; as such, it's
+// not meant for streaming handlers. Panics of the handler are propagated.
+func RequestTimeout(d time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r2 := r.WithContext(ctx)
+
+			bw := newBufferWriter()
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rvr := recover(); rvr != nil {
+						panicked <- rvr
+					}
+				}()
+				next.ServeHTTP(bw, r2)
+				close(done)
+			}()
+
+			select {
+			case rvr := <-panicked:
+				panic(rvr)
+			case <-done:
+				bw.writeTo(w, bw.body.Bytes())
+			case <-ctx.Done():
+				// Rendered for the original request, as the timed out
+				// context would cancel the response.
+				RenderError(w, r, NewErrResponse(http.StatusServiceUnavailable, errors.New("request timeout")))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
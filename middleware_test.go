@@ -0,0 +1,137 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	PlainText(w, r, "ok")
+}
+
+func TestSecureHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		mw   func(next http.Handler) http.Handler
+		want map[string]string
+	}{
+		{"default", SecureHeaders(DefaultSecureHeadersOptions), map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "DENY",
+			"X-XSS-Protection":       "0",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		}},
+		{"disabled", SecureHeaders(SecureHeadersOptions{FrameOptions: "SAMEORIGIN"}), map[string]string{
+			"X-Content-Type-Options": "",
+			"X-Frame-Options":        "SAMEORIGIN",
+			"X-XSS-Protection":       "",
+			"Referrer-Policy":        "",
+		}},
+		{"nosniff", NoSniff, map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.mw(http.HandlerFunc(okHandler)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			for k, want := range tt.want {
+				if _, ok := w.Header()[k]; want == "" && ok {
+					t.Errorf("%s: got %q, want no header", k, w.Header().Get(k))
+				}
+				if got := w.Header().Get(k); got != want {
+					t.Errorf("%s: got %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-A", "b")
+	// "GET / HTTP/1.1\r\n" + "Host: example.com\r\n" + "X-A: b\r\n"
+	if got, want := headerSize(r), 16+19+8; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+}
+
+func TestMaxHeaderSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"under limit", http.Header{"X-Request-Id": {"abc"}}, http.StatusOK},
+		{"over limit", http.Header{"X-Padding": {strings.Repeat("a", 1024)}}, http.StatusRequestHeaderFieldsTooLarge},
+		{"large cookie", http.Header{"Cookie": {"session=" + strings.Repeat("a", 600), "prefs=" + strings.Repeat("b", 600)}}, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+			MaxHeaderSize(1024)(http.HandlerFunc(okHandler)).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	handlerDone := make(chan struct{})
+	h := RequestTimeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		<-release
+		JSON(w, r, M{"late": true})
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	close(release)
+	<-handlerDone
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	if got := decodeProblem(t, w)["detail"]; got != "request timeout" {
+		t.Errorf("got detail %v, want request timeout", got)
+	}
+}
+
+func TestRequestTimeoutInTime(t *testing.T) {
+	h := RequestTimeout(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("request context without deadline")
+		}
+		w.Header().Set("X-Handler", "1")
+		RespondStatus(w, r, http.StatusCreated, M{"a": 1})
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusCreated || w.Header().Get("X-Handler") != "1" {
+		t.Errorf("got status %d and header %v, want the handler's response", w.Code, w.Header())
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"a":1}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestRequestTimeoutPanic(t *testing.T) {
+	h := RequestTimeout(time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	defer func() {
+		if rvr := recover(); rvr != "boom" {
+			t.Errorf("got panic %v, want boom", rvr)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
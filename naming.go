@@ -0,0 +1,514 @@
+package render
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// jsonNamer is the naming strategy applied to struct field names without an
+// explicit json tag name. See SetJSONNamingStrategy.
+var jsonNamer func(fieldName string) string
+
+// SetJSONNamingStrategy sets a package-level strategy used by JSON to derive
+// object keys from Go struct field names, e.g. render.CamelCaseNamer. Fields
+// with an explicit name in their `json` tag keep that name. Pass nil to
+// restore the encoding/json default. Fields of embedded structs are promoted
+// and shadowed as per the encoding/json rules, by their mapped names.
+//
+// It's meant to be called once during program initialization.
+func SetJSONNamingStrategy(fn func(fieldName string) string) {
+	jsonNamer = fn
+}
+
+// CamelCaseNamer converts a field name to camelCase, e.g. "UserID" becomes
+// "userID" and "HTTPServer" becomes "httpServer".
+func CamelCaseNamer(fieldName string) string {
+	rs := []rune(fieldName)
+	for i := 0; i < len(rs) && unicode.IsUpper(rs[i]); i++ {
+		// Keep the last capital of an acronym when it starts the next word.
+		if i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			break
+		}
+		rs[i] = unicode.ToLower(rs[i])
+	}
+	return string(rs)
+}
+
+// SnakeCaseNamer converts a field name to snake_case, e.g. "UserID" becomes
+// "user_id" and "HTTPServer" becomes "http_server".
+func SnakeCaseNamer(fieldName string) string {
+	rs := []rune(fieldName)
+	var sb strings.Builder
+	for i, c := range rs {
+		if unicode.IsUpper(c) {
+			if i > 0 && (!unicode.IsUpper(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				sb.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// PascalCaseNamer converts a field name to PascalCase, e.g. "userID" becomes
+// "UserID".
+func PascalCaseNamer(fieldName string) string {
+	rs := []rune(fieldName)
+	if len(rs) > 0 {
+		rs[0] = unicode.ToUpper(rs[0])
+	}
+	return string(rs)
+}
+
+// reflectJSON is a json.Marshaler that encodes v by walking it via
+// reflection, remapping struct field names with namer and leaving out fields
+// rejected by filter.
+type reflectJSON struct {
+	v      interface{}
+	namer  func(fieldName string) string
+	filter *fieldFilter
+	seen   map[uintptr]bool // pointers being encoded
+}
+
+func (n reflectJSON) MarshalJSON() ([]byte, error) {
+	n.seen = map[uintptr]bool{}
+	buf := &bytes.Buffer{}
+	if err := n.encode(buf, reflect.ValueOf(n.v), ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf(new(json.Marshaler)).Elem()
+	textMarshalerType = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	numberType        = reflect.TypeOf(json.Number(""))
+	isZeroerType      = reflect.TypeOf(new(isZeroer)).Elem()
+)
+
+func (n reflectJSON) encode(buf *bytes.Buffer, v reflect.Value, path string) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	// Composite Renderers are encoded as the Renderer they chose.
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Type().Implements(valueWrapperType) && v.CanInterface() {
+		return n.encode(buf, reflect.ValueOf(unwrapValue(v.Interface())), path)
+	}
+
+	// Types with their own marshalling logic are left to encoding/json,
+	// including the ones with pointer methods for addressable values.
+	if implementsMarshaler(v) {
+		if v.Kind() != reflect.Ptr && v.CanAddr() {
+			v = v.Addr()
+		}
+		return n.marshal(buf, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			// Guard against cycles, which encoding/json reports as errors.
+			p := v.Pointer()
+			if n.seen[p] {
+				return &json.UnsupportedValueError{Value: v, Str: "encountered a cycle via " + v.Type().String()}
+			}
+			n.seen[p] = true
+			defer delete(n.seen, p)
+		}
+		return n.encode(buf, v.Elem(), path)
+
+	case reflect.Struct:
+		buf.WriteByte('{')
+		if _, err := n.encodeFields(buf, v, path, true); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		// Let encoding/json deal with key conversion and ordering, except for
+		// key types it doesn't support, e.g. floats, which are formatted with fmt.
+		keyType := v.Type().Key()
+		stringify := !isJSONKeyType(keyType)
+		if stringify {
+			keyType = reflect.TypeOf("")
+		}
+		m := reflect.MakeMapWithSize(reflect.MapOf(keyType, rawMessageType), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			if stringify {
+				key = reflect.ValueOf(fmt.Sprint(key.Interface()))
+			}
+			var elemPath string
+			if key.Kind() == reflect.String {
+				elemPath = joinPath(path, key.String())
+				if !n.filter.keep(elemPath) {
+					continue
+				}
+			}
+			elem := &bytes.Buffer{}
+			if err := n.encode(elem, iter.Value(), elemPath); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, reflect.ValueOf(json.RawMessage(elem.Bytes())))
+		}
+		return n.marshal(buf, m)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				buf.WriteString("null")
+				return nil
+			}
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				return n.marshal(buf, v) // base64
+			}
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := n.encode(buf, v.Index(i), path); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	default:
+		return n.marshal(buf, v)
+	}
+}
+
+// encodeFields writes the struct fields of v as object members, as per
+// jsonFields.
+func (n reflectJSON) encodeFields(buf *bytes.Buffer, v reflect.Value, path string, first bool) (bool, error) {
+fields:
+	for _, jf := range jsonFields(v.Type(), n.namer) {
+		f := v
+		for _, i := range jf.index {
+			if f.Kind() == reflect.Ptr {
+				if f.IsNil() {
+					continue fields // promoted from a nil embedded pointer
+				}
+				f = f.Elem()
+			}
+			f = f.Field(i)
+		}
+
+		if jf.omitEmpty && isEmptyValue(f) || jf.omitZero && isZeroValue(f) {
+			continue
+		}
+		fieldPath := joinPath(path, jf.name)
+		if !n.filter.keep(fieldPath) {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if err := n.marshal(buf, reflect.ValueOf(jf.name)); err != nil {
+			return first, err
+		}
+		buf.WriteByte(':')
+		if jf.quoted {
+			if err := n.encodeQuoted(buf, f, fieldPath); err != nil {
+				return first, err
+			}
+			continue
+		}
+		if err := n.encode(buf, f, fieldPath); err != nil {
+			return first, err
+		}
+	}
+	return first, nil
+}
+
+// encodeQuoted writes a field tagged with the ",string" option, encoding
+// scalars inside a JSON string like encoding/json does, e.g. 1 as "1" and "a"
+// as "\"a\"".
+func (n reflectJSON) encodeQuoted(buf *bytes.Buffer, v reflect.Value, path string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		v = v.Elem()
+	}
+	// Marshalers ignore the option.
+	if implementsMarshaler(v) {
+		return n.encode(buf, v, path)
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.String && v.Type() != numberType {
+		return n.marshal(buf, reflect.ValueOf(string(b)))
+	}
+	buf.WriteByte('"')
+	buf.Write(b)
+	buf.WriteByte('"')
+	return nil
+}
+
+// jsonField is a struct field encoded as an object member.
+type jsonField struct {
+	name      string
+	tagged    bool
+	index     []int
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+}
+
+// jsonFields returns the fields of struct type t encoded by encoding/json, in
+// order, including the ones promoted from embedded structs, following its
+// rules for hiding ambiguous and shadowed fields. Names not set by a tag are
+// mapped with namer, if any, before those rules apply.
+func jsonFields(t reflect.Type, namer func(fieldName string) string) []jsonField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var (
+		fields    []jsonField
+		next      = []embedded{{typ: t}}
+		count     map[reflect.Type]int
+		nextCount = map[reflect.Type]int{}
+		visited   = map[reflect.Type]bool{}
+	)
+	// Walk embedded structs breadth first, e.g. by depth.
+	for len(next) > 0 {
+		current := next
+		next = nil
+		count, nextCount = nextCount, map[reflect.Type]int{}
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					// Unexported embedded structs may have exported fields.
+					if sf.PkgPath != "" && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" {
+					continue // unexported
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := tag, ""
+				if idx := strings.Index(tag, ","); idx >= 0 {
+					name, opts = tag[:idx], tag[idx+1:]
+				}
+				index := append(append([]int(nil), e.index...), i)
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					nextCount[ft]++
+					if nextCount[ft] == 1 {
+						next = append(next, embedded{typ: ft, index: index})
+					}
+					continue
+				}
+
+				f := jsonField{
+					name:      name,
+					tagged:    name != "",
+					index:     index,
+					omitEmpty: hasOption(opts, "omitempty"),
+					omitZero:  hasOption(opts, "omitzero"),
+				}
+				if hasOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool, reflect.String,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64:
+						f.quoted = true
+					}
+				}
+				if f.name == "" {
+					f.name = sf.Name
+					if namer != nil {
+						f.name = namer(f.name)
+					}
+				}
+				fields = append(fields, f)
+				if count[e.typ] > 1 {
+					// The same struct is embedded several times at this
+					// depth, so its fields are ambiguous.
+					fields = append(fields, f)
+				}
+			}
+		}
+	}
+
+	// Keep the dominant field of each name: the shallowest one, or the
+	// tagged one among the shallowest, if there is exactly one.
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) != len(fields[i+1].index) || fields[i].tagged != fields[i+1].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].index, out[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return out
+}
+
+// implementsMarshaler reports whether encoding/json encodes v with a
+// json.Marshaler or encoding.TextMarshaler method, which is the case for
+// pointer methods of addressable values too.
+func implementsMarshaler(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	if t.Kind() == reflect.Ptr || !v.CanAddr() {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType)
+}
+
+func (n reflectJSON) marshal(buf *bytes.Buffer, v reflect.Value) error {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+func isUnsupportedJSON(err error) bool {
+	switch err.(type) {
+	case *json.UnsupportedTypeError, *json.UnsupportedValueError:
+		return true
+	}
+	return false
+}
+
+// isJSONKeyType reports whether encoding/json supports t as map key type.
+func isJSONKeyType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return t.Implements(textMarshalerType)
+}
+
+func hasOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroValue reports whether v is the zero value as per the omitzero
+// option, which defers to an IsZero method, if any.
+func isZeroValue(v reflect.Value) bool {
+	t := v.Type()
+	switch {
+	case (t.Kind() == reflect.Interface || t.Kind() == reflect.Ptr) && t.Implements(isZeroerType):
+		if v.IsNil() || v.Kind() == reflect.Interface && v.Elem().Kind() == reflect.Ptr && v.Elem().IsNil() {
+			return true
+		}
+		return v.Interface().(isZeroer).IsZero()
+	case t.Implements(isZeroerType):
+		return v.Interface().(isZeroer).IsZero()
+	case reflect.PtrTo(t).Implements(isZeroerType):
+		if !v.CanAddr() {
+			v2 := reflect.New(t).Elem()
+			v2.Set(v)
+			v = v2
+		}
+		return v.Addr().Interface().(isZeroer).IsZero()
+	}
+	return v.IsZero()
+}
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
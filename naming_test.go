@@ -0,0 +1,232 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type namingUser struct {
+	UserID     int
+	HTTPServer string
+	FirstName  string
+	Email      string `json:"mail"`
+}
+
+func TestJSONNamingStrategy(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+
+	tests := []struct {
+		name  string
+		namer func(string) string
+		want  string
+	}{
+		{"default", nil, `{"UserID":1,"HTTPServer":"a","FirstName":"b","mail":"c"}`},
+		{"camel", CamelCaseNamer, `{"userID":1,"httpServer":"a","firstName":"b","mail":"c"}`},
+		{"snake", SnakeCaseNamer, `{"user_id":1,"http_server":"a","first_name":"b","mail":"c"}`},
+		{"pascal", PascalCaseNamer, `{"UserID":1,"HTTPServer":"a","FirstName":"b","mail":"c"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetJSONNamingStrategy(tt.namer)
+			w := httptest.NewRecorder()
+			JSON(w, httptest.NewRequest("GET", "/", nil), namingUser{1, "a", "b", "c"})
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamers(t *testing.T) {
+	tests := []struct {
+		namer func(string) string
+		in    string
+		want  string
+	}{
+		{CamelCaseNamer, "UserID", "userID"},
+		{CamelCaseNamer, "HTTPServer", "httpServer"},
+		{CamelCaseNamer, "ID", "id"},
+		{SnakeCaseNamer, "UserID", "user_id"},
+		{SnakeCaseNamer, "HTTPServer", "http_server"},
+		{SnakeCaseNamer, "Name", "name"},
+		{PascalCaseNamer, "userID", "UserID"},
+		{PascalCaseNamer, "", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.namer(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJSONNamingStrategyNested(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+	SetJSONNamingStrategy(SnakeCaseNamer)
+
+	type inner struct{ LastName string }
+	v := M{"Users": []struct {
+		UserID int
+		Inner  inner
+	}{{1, inner{"x"}}}}
+
+	buf := &bytes.Buffer{}
+	if err := marshalJSON(buf, v, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Users":[{"user_id":1,"inner":{"last_name":"x"}}]}`
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+type (
+	shadowA struct {
+		X int
+		Y int
+	}
+	shadowB struct {
+		shadowA
+		X int
+	}
+	ambiguousC struct{ Z int }
+	ambiguousD struct{ Z int }
+	ambiguous  struct {
+		ambiguousC
+		ambiguousD
+	}
+	taggedE struct {
+		Z int `json:"Z"`
+	}
+	tagged struct {
+		ambiguousC
+		taggedE
+	}
+	unexportedEmbed struct {
+		shadowA
+		*ambiguousC
+	}
+	quoted struct {
+		S   string      `json:",string"`
+		I   int         `json:",string"`
+		B   bool        `json:",string"`
+		F   float64     `json:",string"`
+		P   *int        `json:",string"`
+		N   *int        `json:",string"`
+		Num json.Number `json:",string"`
+		T   time.Time   `json:",string"`
+		Sl  []int       `json:",string"`
+	}
+	omitted struct {
+		A string    `json:",omitempty"`
+		B *int      `json:",omitempty"`
+		C time.Time `json:",omitzero"`
+		D []int     `json:",omitempty"`
+		E [0]int    `json:",omitempty"`
+		F struct{}  `json:",omitzero"`
+		G int       `json:"-"`
+		H int       `json:"-,"`
+	}
+	ptrMarshaler  struct{ V int }
+	withMarshaler struct {
+		M  ptrMarshaler
+		PM *ptrMarshaler
+		Ms []ptrMarshaler
+	}
+	embeddedPtr struct {
+		*shadowA
+		Z int
+	}
+)
+
+func (m *ptrMarshaler) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int{"marshaled": m.V})
+}
+
+// jsonEquivalenceValues are values encoding/json has specific rules for.
+func jsonEquivalenceValues() map[string]interface{} {
+	one := 1
+	return map[string]interface{}{
+		"shadowed":         shadowB{shadowA{1, 2}, 3},
+		"ambiguous":        ambiguous{ambiguousC{1}, ambiguousD{2}},
+		"tagged":           tagged{ambiguousC{1}, taggedE{2}},
+		"unexported embed": unexportedEmbed{shadowA{1, 2}, &ambiguousC{3}},
+		"nil embed":        unexportedEmbed{shadowA: shadowA{1, 2}},
+		"quoted":           quoted{S: `a"<b>`, I: 1, B: true, F: 1.5, P: &one, Num: "12", Sl: []int{1}},
+		"omitted":          omitted{G: 1, H: 2},
+		"not omitted":      omitted{A: "a", B: &one, C: time.Unix(0, 0).UTC(), D: []int{}},
+		"marshaler":        withMarshaler{ptrMarshaler{1}, &ptrMarshaler{2}, []ptrMarshaler{{3}}},
+		"marshaler ptr":    &withMarshaler{ptrMarshaler{1}, nil, nil},
+		"embedded ptr":     embeddedPtr{&shadowA{1, 2}, 3},
+		"nil embedded ptr": embeddedPtr{Z: 3},
+		"map":              map[string]interface{}{"b": shadowB{}, "a": []interface{}{nil, 1.5, "x"}},
+		"int map":          map[int]string{2: "b", 1: "a"},
+		"bytes":            []byte("hello"),
+		"nil":              nil,
+	}
+}
+
+// TestReflectJSONEquivalence checks that encoding through reflectJSON yields
+// the same document as encoding/json.
+func TestReflectJSONEquivalence(t *testing.T) {
+	for name, v := range jsonEquivalenceValues() {
+		t.Run(name, func(t *testing.T) {
+			want, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(reflectJSON{v: v})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestReflectJSONCycle(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+
+	_, err := json.Marshal(reflectJSON{v: n})
+	var unsupported *json.UnsupportedValueError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("got %v, want a *json.UnsupportedValueError", err)
+	}
+}
+
+func TestJSONNonStringMapKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"int", map[int]string{2: "b", 1: "a"}, `{"1":"a","2":"b"}`},
+		{"uint64", map[uint64]bool{1: true}, `{"1":true}`},
+		{"float32", map[float32]interface{}{1.5: "a", 2: nil}, `{"1.5":"a","2":null}`},
+		{"bool", map[bool]int{true: 1, false: 0}, `{"false":0,"true":1}`},
+		{"nested", struct{ M map[float64]int }{map[float64]int{0.25: 1}}, `{"M":{"0.25":1}}`},
+		{"string", map[string]interface{}{"b": 1, "a": []int{1}}, `{"a":[1],"b":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			JSON(w, httptest.NewRequest("GET", "/", nil), tt.v)
+			if w.Code != 200 {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
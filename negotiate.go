@@ -0,0 +1,267 @@
+package render
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Negotiate returns the supported ContentType best matching the request
+// Accept header, taking quality values and wildcards, such as "*/*",
+// "application/*" or "*/json", into account. Media
+// types the server doesn't support are skipped. The quality of a content type
+// is the one of the most specific range matching it, so that a zero quality
+// excludes it, e.g. in "application/json;q=0, */*", and equally acceptable
+// types are ranked by the specificity of their range, then by the order of
+// the header. It defaults to ContentTypeJSON when there is no match. A content
+// type forced with SetContentType always wins.
+func Negotiate(r *http.Request, supported ...ContentType) ContentType {
+	if contentType, ok := negotiate(r, supported); ok {
+		return contentType
+	}
+	return ContentTypeJSON
+}
+
+// negotiate is like Negotiate, but reports whether there was a match.
+func negotiate(r *http.Request, supported []ContentType) (ContentType, bool) {
+	if contentType, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); ok {
+		return contentType, true
+	}
+
+	ranges := parseAccept(r.Header.Get("Accept"))
+	best, bestRange := ContentTypeUnknown, -1
+	for _, contentType := range supported {
+		i := matchAccept(ranges, contentType)
+		if i < 0 || ranges[i].q <= 0 {
+			// Not accepted, or explicitly refused with a zero quality.
+			continue
+		}
+		if bestRange < 0 || preferredRange(ranges, i, bestRange) {
+			best, bestRange = contentType, i
+		}
+	}
+	return best, bestRange >= 0
+}
+
+// negotiateResponse is like negotiate, for responders defaulting to JSON,
+// which supported includes: requests accepting JSON only through a wildcard,
+// such as the "*/*" of browsers, get JSON rather than whichever other
+// supported type they happen to list, e.g. the application/xml in the Accept
+// header of Chrome. Clients listing JSON explicitly, or excluding it, are
+// negotiated with as usual.
+func negotiateResponse(r *http.Request, supported []ContentType) (ContentType, bool) {
+	if _, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); !ok {
+		ranges := parseAccept(r.Header.Get("Accept"))
+		i := matchAccept(ranges, ContentTypeJSON)
+		if i >= 0 && ranges[i].q > 0 && specificity(ranges[i].mediaType) < 2 {
+			return ContentTypeJSON, true
+		}
+	}
+	return negotiate(r, supported)
+}
+
+// acceptsJSON reports whether JSON is an acceptable response to r, which
+// didn't force another content type.
+func acceptsJSON(r *http.Request) bool {
+	if contentType, ok := r.Context().Value(ContentTypeCtxKey).(ContentType); ok {
+		return contentType == ContentTypeJSON
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	ranges := parseAccept(accept)
+	i := matchAccept(ranges, ContentTypeJSON)
+	return i >= 0 && ranges[i].q > 0
+}
+
+// Router is a http.Handler dispatching requests to the handler of the
+// content type negotiated from their Accept header, e.g. to serve JSON to API
+// clients and HTML to browsers on the same route:
+//
+//	r.Get("/articles", render.NewRouter().
+//		Handle(render.ContentTypeJSON, listArticlesJSON).
+//		Handle(render.ContentTypeHTML, listArticlesHTML))
+//
+// Requests are passed on as is, along with their path and query parameters.
+type Router struct {
+	handlers  map[ContentType]http.Handler
+	supported []ContentType
+	fallback  http.Handler
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return &Router{handlers: map[ContentType]http.Handler{}}
+}
+
+// RouterFor returns a Router for the given pairs of ContentType and
+// http.Handler, e.g. RouterFor(ContentTypeJSON, jsonHandler). It panics on
+// malformed pairs.
+func RouterFor(pairs ...interface{}) *Router {
+	if len(pairs)%2 != 0 {
+		panic("render: RouterFor expects pairs of ContentType and http.Handler")
+	}
+	rt := NewRouter()
+	for i := 0; i < len(pairs); i += 2 {
+		ct, ok := pairs[i].(ContentType)
+		if !ok {
+			panic(fmt.Sprintf("render: RouterFor expects a ContentType, not %T", pairs[i]))
+		}
+		h, ok := pairs[i+1].(http.Handler)
+		if !ok {
+			panic(fmt.Sprintf("render: RouterFor expects a http.Handler, not %T", pairs[i+1]))
+		}
+		rt.Handle(ct, h)
+	}
+	return rt
+}
+
+// Handle sets the handler of the given content type. Content types are
+// preferred in the order they are added for equally acceptable ones.
+func (rt *Router) Handle(ct ContentType, h http.Handler) *Router {
+	if _, ok := rt.handlers[ct]; !ok {
+		rt.supported = append(rt.supported, ct)
+	}
+	rt.handlers[ct] = h
+	return rt
+}
+
+// Default sets the handler of requests not accepting any of the content
+// types handled. Without it, they get a 406 Not Acceptable response.
+func (rt *Router) Default(h http.Handler) *Router {
+	rt.fallback = h
+	return rt
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = AddVary(r, "Accept")
+	if ct, ok := negotiate(r, rt.supported); ok {
+		if h, ok := rt.handlers[ct]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	if rt.fallback != nil {
+		rt.fallback.ServeHTTP(w, r)
+		return
+	}
+	RenderError(w, r, NewErrResponse(http.StatusNotAcceptable, nil))
+}
+
+// acceptRange is a media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into its media ranges, in order.
+// Ranges with a malformed quality value are left out.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, field := range splitHeaderList(header) {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(field))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// matchAccept returns the index of the range of ranges applying to the
+// ContentType, the most specific one matching it, or -1 if none does. Hence
+// in "application/json;q=0, */*", JSON is refused despite the wildcard.
+func matchAccept(ranges []acceptRange, target ContentType) int {
+	match := -1
+	for i, accept := range ranges {
+		if !matchesWildcard(accept.mediaType, target) {
+			continue
+		}
+		if match < 0 || specificity(accept.mediaType) > specificity(ranges[match].mediaType) {
+			match = i
+		}
+	}
+	return match
+}
+
+// preferredRange reports whether the range at index i is preferred over the
+// one at index j: by quality, then specificity, then order in the header.
+func preferredRange(ranges []acceptRange, i, j int) bool {
+	if ranges[i].q != ranges[j].q {
+		return ranges[i].q > ranges[j].q
+	}
+	if si, sj := specificity(ranges[i].mediaType), specificity(ranges[j].mediaType); si != sj {
+		return si > sj
+	}
+	return i < j
+}
+
+// specificity ranks media ranges, from "*/*", the least specific, to "type/*"
+// or "*/subtype", to exact media types.
+func specificity(mediaType string) int {
+	typ, subtype := splitMediaType(mediaType)
+	n := 0
+	if typ != "*" {
+		n++
+	}
+	if subtype != "*" {
+		n++
+	}
+	return n
+}
+
+// matchesWildcard reports whether the media range pattern matches the
+// ContentType. The type and subtype are compared separately, so that either
+// can be a wildcard, e.g. "application/*", "*/json" or "*/*".
+func matchesWildcard(pattern string, target ContentType) bool {
+	patternType, patternSubtype := splitMediaType(pattern)
+	if patternType != "*" && patternSubtype != "*" {
+		return GetContentType(pattern) == target
+	}
+	targetType, targetSubtype := splitMediaType(target.String())
+	if targetType == "" {
+		return false
+	}
+	return (patternType == "*" || patternType == targetType) &&
+		(patternSubtype == "*" || patternSubtype == targetSubtype)
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	i := strings.Index(mediaType, "/")
+	if i < 0 {
+		return mediaType, ""
+	}
+	return mediaType[:i], mediaType[i+1:]
+}
+
+// splitHeaderList splits a comma separated header value, e.g. Accept, into its
+// elements, leaving commas within quoted strings, e.g. in media type
+// parameters such as profile="https://example.com/a,b", alone.
+func splitHeaderList(header string) []string {
+	var (
+		fields []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case quoted && c == '\\':
+			i++ // skip the escaped character
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			fields = append(fields, header[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, header[start:])
+}
@@ -0,0 +1,255 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func acceptRequest(accept string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	return r
+}
+
+func TestNegotiate(t *testing.T) {
+	supported := []ContentType{ContentTypeJSON, ContentTypeXML, ContentTypeHTML}
+	tests := []struct {
+		name   string
+		accept string
+		want   ContentType
+	}{
+		{"single", "application/xml", ContentTypeXML},
+		{"first of equal quality", "text/html, application/xml", ContentTypeHTML},
+		{"quality", "text/html;q=0.5, application/xml;q=0.9", ContentTypeXML},
+		{"default quality", "application/xml;q=0.9, text/html", ContentTypeHTML},
+		{"unsupported skipped", "image/png, application/xml;q=0.1", ContentTypeXML},
+		{"zero quality", "application/xml;q=0, text/html;q=0.1", ContentTypeHTML},
+		{"invalid quality", "application/xml;q=x, text/html;q=0.1", ContentTypeHTML},
+		{"alias", "text/xml", ContentTypeXML},
+		{"parameters", "application/json; charset=utf-8", ContentTypeJSON},
+		{"quoted parameter", `application/json;profile="https://example.com/schema"`, ContentTypeJSON},
+		{"quoted comma", `image/png;x="a,text/html", application/xml;q=0.5`, ContentTypeXML},
+		{"no match", "image/png", ContentTypeJSON},
+		{"no header", "", ContentTypeJSON},
+		{"malformed", "//;;", ContentTypeJSON},
+		{"excluded", "application/json;q=0, */*", ContentTypeXML},
+		{"excluded alias", "text/javascript;q=0, */*", ContentTypeXML},
+		{"specific first", "*/*, text/html", ContentTypeHTML},
+		{"specific quality", "application/*;q=0.2, application/xml;q=0.1, */*;q=0.5", ContentTypeHTML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(acceptRequest(tt.accept), supported...); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitHeaderList(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{""}},
+		{"a", []string{"a"}},
+		{"a, b,c", []string{"a", " b", "c"}},
+		{`a;p="x,y", b`, []string{`a;p="x,y"`, " b"}},
+		{`a;p="x\",y", b`, []string{`a;p="x\",y"`, " b"}},
+		{"a,", []string{"a", ""}},
+	}
+	for _, tt := range tests {
+		got := splitHeaderList(tt.header)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptedContentTypeQuoted(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   ContentType
+	}{
+		{`application/json;profile="https://example.com/schema"`, ContentTypeJSON},
+		{`application/json;profile="https://example.com/a,b", text/html`, ContentTypeJSON},
+		{"text/*,application/*,*/*", ContentTypePlainText},
+	}
+	for _, tt := range tests {
+		if got := AcceptedContentType(acceptRequest(tt.accept)); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateForced(t *testing.T) {
+	r := WithContentType(acceptRequest("application/xml"), ContentTypePlainText)
+	if got := Negotiate(r, ContentTypeJSON, ContentTypeXML); got != ContentTypePlainText {
+		t.Errorf("got %v, want the forced content type", got)
+	}
+}
+
+func TestMatchesWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		target  ContentType
+		want    bool
+	}{
+		{"*/*", ContentTypeJSON, true},
+		{"*/*", ContentTypeHTML, true},
+		{"application/*", ContentTypeJSON, true},
+		{"application/*", ContentTypeXML, true},
+		{"application/*", ContentTypeHTML, false},
+		{"text/*", ContentTypeHTML, true},
+		{"*/json", ContentTypeJSON, true},
+		{"*/json", ContentTypeXML, false},
+		{"*/xml", ContentTypeXML, true},
+		{"application/json", ContentTypeJSON, true},
+		{"text/javascript", ContentTypeJSON, true},
+		{"application/json", ContentTypeXML, false},
+		{"*/*", ContentTypeUnknown, false},
+	}
+	for _, tt := range tests {
+		if got := matchesWildcard(tt.pattern, tt.target); got != tt.want {
+			t.Errorf("%s matching %v: got %v, want %v", tt.pattern, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateWildcards(t *testing.T) {
+	tests := []struct {
+		name      string
+		accept    string
+		supported []ContentType
+		want      ContentType
+	}{
+		{"any", "*/*", []ContentType{ContentTypeXML, ContentTypeJSON}, ContentTypeXML},
+		{"type", "text/*", []ContentType{ContentTypeJSON, ContentTypeHTML}, ContentTypeHTML},
+		{"subtype", "*/xml", []ContentType{ContentTypeJSON, ContentTypeXML}, ContentTypeXML},
+		{"exact first", "application/xml, */*;q=0.1", []ContentType{ContentTypeJSON, ContentTypeXML}, ContentTypeXML},
+		{"quality", "text/*;q=0.5,application/*;q=0.9,*/*;q=0.1", []ContentType{ContentTypeHTML, ContentTypeXML}, ContentTypeXML},
+		{"any fallback", "text/*,application/*;q=0,*/*;q=0.1", []ContentType{ContentTypeJSON, ContentTypeHTML}, ContentTypeHTML},
+		{"type over any", "*/*, application/*;q=1", []ContentType{ContentTypeHTML, ContentTypeXML}, ContentTypeXML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(acceptRequest(tt.accept), tt.supported...); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultResponderAnyAccept(t *testing.T) {
+	w := httptest.NewRecorder()
+	Respond(w, acceptRequest("*/*"), M{"a": 1})
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want JSON", got)
+	}
+}
+
+// namedHandler responds with its name, along with the query of the request.
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		PlainText(w, r, name+" "+r.URL.RawQuery)
+	})
+}
+
+func TestRouter(t *testing.T) {
+	rt := NewRouter().
+		Handle(ContentTypeJSON, namedHandler("json")).
+		Handle(ContentTypeHTML, namedHandler("html"))
+	tests := []struct {
+		name   string
+		router *Router
+		accept string
+		want   string
+		status int
+	}{
+		{"json", rt, "application/json", "json page=2", http.StatusOK},
+		{"html", rt, "text/html,application/xhtml+xml;q=0.9", "html page=2", http.StatusOK},
+		{"any prefers first", rt, "*/*", "json page=2", http.StatusOK},
+		{"excluded", rt, "application/json;q=0, */*", "html page=2", http.StatusOK},
+		{"not acceptable", rt, "image/png", "", http.StatusNotAcceptable},
+		{"default", RouterFor(ContentTypeJSON, namedHandler("json")).Default(namedHandler("default")), "image/png", "default page=2", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/articles?page=2", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			tt.router.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.want)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("got Vary %q, want Accept", got)
+			}
+		})
+	}
+}
+
+func TestRouterForMalformed(t *testing.T) {
+	tests := map[string][]interface{}{
+		"odd":         {ContentTypeJSON},
+		"not a type":  {"json", namedHandler("json")},
+		"not handler": {ContentTypeJSON, "json"},
+	}
+	for name, pairs := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("got no panic")
+				}
+			}()
+			RouterFor(pairs...)
+		})
+	}
+}
+
+func TestContentNegotiationError(t *testing.T) {
+	w := httptest.NewRecorder()
+	ContentNegotiationError(w, acceptRequest("text/csv"), ContentTypeJSON, ContentTypeXML)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("got status %d, want 406", w.Code)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"supported":["application/json","application/xml"]}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestStrictNegotiation(t *testing.T) {
+	defer func(prev bool) { StrictNegotiation = prev }(StrictNegotiation)
+
+	tests := []struct {
+		name   string
+		strict bool
+		accept string
+		want   int
+	}{
+		{"strict unsupported", true, "text/csv", http.StatusNotAcceptable},
+		{"strict supported", true, "text/csv, application/xml;q=0.5", http.StatusOK},
+		{"strict no header", true, "", http.StatusOK},
+		{"lenient unsupported", false, "text/csv", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			StrictNegotiation = tt.strict
+			w := httptest.NewRecorder()
+			Respond(w, acceptRequest(tt.accept), &namedPayload{Name: "gopher"})
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), `"application/xml"`) {
+				t.Errorf("got %s, want the supported types listed", w.Body.String())
+			}
+		})
+	}
+}
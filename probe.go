@@ -0,0 +1,98 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ProbeTimeout bounds the time Probe waits for its checks. Checks still
+// running once it elapses, or once the request is canceled, are reported as
+// failing. Zero means no timeout.
+var ProbeTimeout = 10 * time.Second
+
+// Probe returns a handler for Kubernetes-style readiness probes. It runs all
+// named checks concurrently and responds with 200 OK and a JSON body like
+// {"status":"ok","checks":{"db":"ok"}} if all of them pass, or with 503
+// Service Unavailable and the error messages of the failing checks otherwise.
+// A panic in a check is recovered and reported as its failure, and checks
+// not done within ProbeTimeout fail with a timeout.
+// The response is always JSON, regardless of the request Accept header.
+func Probe(checks map[string]func() error) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if ProbeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ProbeTimeout)
+			defer cancel()
+		}
+
+		type checkResult struct {
+			name string
+			err  error
+		}
+		// Buffered, so that checks done after the timeout don't block.
+		done := make(chan checkResult, len(checks))
+		for name, check := range checks {
+			go func(name string, check func() error) {
+				done <- checkResult{name, runCheck(check)}
+			}(name, check)
+		}
+
+		var (
+			failed  bool
+			results = make(map[string]string, len(checks))
+		)
+	wait:
+		for range checks {
+			select {
+			case res := <-done:
+				results[res.name] = "ok"
+				if res.err != nil {
+					results[res.name] = res.err.Error()
+					failed = true
+				}
+			case <-ctx.Done():
+				for name := range checks {
+					if _, ok := results[name]; !ok {
+						results[name] = "check timed out: " + ctx.Err().Error()
+					}
+				}
+				failed = true
+				break wait
+			}
+		}
+
+		status := "ok"
+		if failed {
+			status = "error"
+			Status(r, http.StatusServiceUnavailable)
+		}
+		JSON(w, r, M{"status": status, "checks": results})
+	}
+	return http.HandlerFunc(fn)
+}
+
+// runCheck runs a Probe check, returning a panic as error.
+func runCheck(check func() error) (err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("render: check panic: %v", rvr)
+		}
+	}()
+	return check()
+}
+
+// LivenessProbe is a middleware that responds to "GET /healthz" with 200 OK
+// and {"status":"ok"}, without calling the next handler.
+func LivenessProbe(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/healthz" {
+			JSON(w, r, M{"status": "ok"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,125 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	ok := func() error { return nil }
+	tests := []struct {
+		name       string
+		checks     map[string]func() error
+		wantStatus int
+		wantBody   string
+	}{
+		{"ok", map[string]func() error{"db": ok, "redis": ok}, http.StatusOK, `{"checks":{"db":"ok","redis":"ok"},"status":"ok"}`},
+		{"failing", map[string]func() error{"db": ok, "redis": func() error { return errors.New("connection refused") }},
+			http.StatusServiceUnavailable, `{"checks":{"db":"ok","redis":"connection refused"},"status":"error"}`},
+		{"no checks", nil, http.StatusOK, `{"checks":{},"status":"ok"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/readyz", nil)
+			r.Header.Set("Accept", "application/xml")
+			w := httptest.NewRecorder()
+			Probe(tt.checks).ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody+"\n" {
+				t.Errorf("got %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestProbeConcurrent checks that the checks run concurrently: each of them
+// waits for all the others to start.
+func TestProbeConcurrent(t *testing.T) {
+	const n = 3
+	var started sync.WaitGroup
+	started.Add(n)
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+
+	check := func() error {
+		started.Done()
+		select {
+		case <-allStarted:
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("checks run sequentially")
+		}
+	}
+	w := httptest.NewRecorder()
+	Probe(map[string]func() error{"a": check, "b": check, "c": check}).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestProbePanic(t *testing.T) {
+	w := httptest.NewRecorder()
+	Probe(map[string]func() error{
+		"db":    func() error { return nil },
+		"redis": func() error { panic("nil pool") },
+	}).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	want := `{"checks":{"db":"ok","redis":"render: check panic: nil pool"},"status":"error"}` + "\n"
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+		t.Errorf("got %d %s, want 503 %s", w.Code, w.Body.String(), want)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	defer func(d time.Duration) { ProbeTimeout = d }(ProbeTimeout)
+	ProbeTimeout = 10 * time.Millisecond
+
+	hung := make(chan struct{})
+	defer close(hung)
+	checks := map[string]func() error{
+		"db":    func() error { return nil },
+		"redis": func() error { <-hung; return nil },
+	}
+
+	w := httptest.NewRecorder()
+	Probe(checks).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	want := `{"checks":{"db":"ok","redis":"check timed out: context deadline exceeded"},"status":"error"}` + "\n"
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+		t.Errorf("got %d %s, want 503 %s", w.Code, w.Body.String(), want)
+	}
+
+	// Canceled requests don't wait for the hung check either.
+	ProbeTimeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Probe(checks).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil).WithContext(ctx))
+}
+
+func TestLivenessProbe(t *testing.T) {
+	h := LivenessProbe(http.HandlerFunc(okHandler))
+	tests := []struct {
+		method, target string
+		want           string
+	}{
+		{"GET", "/healthz", "{\"status\":\"ok\"}\n"},
+		{"POST", "/healthz", "ok"},
+		{"GET", "/healthz/db", "ok"},
+		{"GET", "/", "ok"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("%s %s: got %d %q, want %q", tt.method, tt.target, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
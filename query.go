@@ -0,0 +1,135 @@
+package render
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ajg/form"
+)
+
+// URLEncode encodes v, e.g. a struct of filters, into url.Values the same way
+// DecodeForm decodes them: fields are named as per their `form` tags, nested
+// struct fields are keyed with dots, e.g. "page.size", slice elements with
+// their index, e.g. "tags.0", and empty fields tagged omitempty are left out.
+func URLEncode(v interface{}) (url.Values, error) {
+	values, err := form.EncodeToValues(v)
+	if err != nil {
+		return nil, err
+	}
+	// ajg/form collapses a struct without any non-empty field into a single
+	// empty value without a key.
+	if vs, ok := values[""]; ok && len(vs) == 1 && vs[0] == "" {
+		delete(values, "")
+	}
+	return values, nil
+}
+
+// QueryString is like URLEncode, but returns the values as a query string,
+// prefixed with "?" unless empty, ready to be appended to an outbound URL.
+func QueryString(v interface{}) (string, error) {
+	values, err := URLEncode(v)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return "?" + values.Encode(), nil
+}
+
+// QueryDecoder decodes URL query parameters into a struct the same way
+// DecodeForm decodes forms, as per their `form` tags, ignoring unknown
+// parameters. Slice fields accept repeated parameters, e.g. "?tags=a&tags=b".
+type QueryDecoder struct {
+	// CommaSeparated also splits the values of slice fields tagged
+	// `query:",csv"` on commas, e.g. "?tags=a,b,c", as per CSV quoting rules,
+	// so that "?tags=\"a,b\",c" results in "a,b" and "c".
+	CommaSeparated bool
+}
+
+// CommaSeparatedQueryDecoder is a QueryDecoder splitting comma separated
+// values, see QueryDecoder.CommaSeparated.
+var CommaSeparatedQueryDecoder = QueryDecoder{CommaSeparated: true}
+
+// DecodeQuery decodes the URL query parameters of r into v, see
+// QueryDecoder.
+func DecodeQuery(r *http.Request, v interface{}) error {
+	return QueryDecoder{}.Decode(r.URL.Query(), v)
+}
+
+// Decode decodes values into v, which must be a pointer to a struct.
+func (d QueryDecoder) Decode(values url.Values, v interface{}) error {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errors.New("render: QueryDecoder expects a pointer to a struct")
+	}
+
+	normalized := url.Values{}
+	for k, vs := range values {
+		normalized[k] = vs
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Type.Kind() != reflect.Slice || sf.Type.Elem().Kind() == reflect.Uint8 {
+			continue
+		}
+		key := sf.Name
+		if name := strings.SplitN(sf.Tag.Get("form"), ",", 2)[0]; name != "" {
+			key = name
+		}
+		vs, ok := normalized[key]
+		if !ok {
+			continue
+		}
+		if d.CommaSeparated && hasOption(queryTagOptions(sf), "csv") {
+			split, err := splitCSV(vs)
+			if err != nil {
+				return fmt.Errorf("render: query parameter %q: %w", key, err)
+			}
+			vs = split
+		}
+
+		// ajg/form expects indexed keys for slices, e.g. "tags.0".
+		delete(normalized, key)
+		for j, s := range vs {
+			normalized[key+"."+strconv.Itoa(j)] = []string{s}
+		}
+	}
+
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	return dec.DecodeValues(v, normalized)
+}
+
+func queryTagOptions(sf reflect.StructField) string {
+	tag := sf.Tag.Get("query")
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		return tag[idx+1:]
+	}
+	return ""
+}
+
+// splitCSV splits each of values as a CSV record.
+func splitCSV(values []string) ([]string, error) {
+	var out []string
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		record, err := csv.NewReader(strings.NewReader(v)).Read()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, record...)
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type (
+	queryPage struct {
+		Size   int `form:"size"`
+		Number int `form:"number,omitempty"`
+	}
+	queryFilter struct {
+		Name   string    `form:"name"`
+		Active bool      `form:"active"`
+		Score  float64   `form:"score"`
+		Tags   []string  `form:"tags"`
+		Page   queryPage `form:"page"`
+		Sort   string    `form:"sort,omitempty"`
+	}
+)
+
+func TestURLEncode(t *testing.T) {
+	got, err := URLEncode(queryFilter{Name: "a b", Active: true, Score: 1.5, Tags: []string{"x", "y"}, Page: queryPage{Size: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"name":      {"a b"},
+		"active":    {"true"},
+		"score":     {"1.5"},
+		"tags.0":    {"x"},
+		"tags.1":    {"y"},
+		"page.size": {"10"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	got, err := QueryString(queryPage{Size: 10, Number: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "?number=2&size=10"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, err := QueryString(struct {
+		Sort string `form:"sort,omitempty"`
+	}{}); err != nil || got != "" {
+		t.Errorf("got %q, %v, want an empty query string", got, err)
+	}
+}
+
+type queryList struct {
+	Tags   []string `form:"tags" query:",csv"`
+	IDs    []int    `form:"ids" query:",csv"`
+	Names  []string `form:"names"`
+	Search string   `form:"q"`
+}
+
+func TestDecodeQuery(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?tags=a&tags=b&ids=1&ids=2&q=x,y&names=c,d&unknown=1", nil)
+	var got queryList
+	if err := DecodeQuery(r, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := queryList{Tags: []string{"a", "b"}, IDs: []int{1, 2}, Names: []string{"c,d"}, Search: "x,y"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCommaSeparatedQueryDecoder(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		want   queryList
+	}{
+		{"strings", url.Values{"tags": {"a,b,c"}}, queryList{Tags: []string{"a", "b", "c"}}},
+		{"ints", url.Values{"ids": {"1,2,3"}}, queryList{IDs: []int{1, 2, 3}}},
+		{"quoted", url.Values{"tags": {`"a,b",c`}}, queryList{Tags: []string{"a,b", "c"}}},
+		{"multi-value and csv", url.Values{"tags": {"a,b", "c"}, "ids": {"1", "2,3"}}, queryList{Tags: []string{"a", "b", "c"}, IDs: []int{1, 2, 3}}},
+		{"not csv", url.Values{"names": {"a,b"}, "q": {"x,y"}}, queryList{Names: []string{"a,b"}, Search: "x,y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got queryList
+			if err := CommaSeparatedQueryDecoder.Decode(tt.values, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryDecoderErrors(t *testing.T) {
+	var list queryList
+	if err := CommaSeparatedQueryDecoder.Decode(url.Values{"tags": {`"a`}}, &list); err == nil {
+		t.Error("got no error for malformed CSV")
+	}
+	if err := CommaSeparatedQueryDecoder.Decode(url.Values{"ids": {"1,x"}}, &list); err == nil {
+		t.Error("got no error for an invalid int")
+	}
+	var notStruct []string
+	if err := (QueryDecoder{}).Decode(url.Values{}, &notStruct); err == nil {
+		t.Error("got no error for a non-struct value")
+	}
+}
@@ -0,0 +1,41 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+)
+
+// Redirect returns a handler that redirects each request to the given URL
+// with the given status code, like http.RedirectHandler, but with a response
+// body encoded as per the request Accept header: an HTML page, a JSON object
+// of the form {"redirect": url} or the plain URL. Like http.Redirect,
+// relative URLs are resolved against the request path, not its host, which
+// comes from the client, nor its scheme, which a TLS-terminating proxy hides:
+// "c" redirects "/a/b" to "/a/c".
+func Redirect(url string, code int) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		location := resolveLocation(r, url)
+		w.Header().Set("Location", location)
+		Status(r, code)
+
+		switch AcceptedContentType(r) {
+		case ContentTypeHTML:
+			HTML(w, r, fmt.Sprintf("<a href=\"%s\">%s</a>.\n", html.EscapeString(location), html.EscapeString(StatusText(code))))
+		case ContentTypeJSON:
+			JSON(w, r, M{"redirect": location})
+		default:
+			PlainText(w, r, location)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func resolveLocation(r *http.Request, location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return location
+	}
+	return (&url.URL{Path: r.URL.Path}).ResolveReference(u).String()
+}
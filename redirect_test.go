@@ -0,0 +1,70 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		wantType string
+		wantBody string
+	}{
+		{"html", "text/html", "text/html; charset=utf-8", `<a href="/new">See Other</a>.` + "\n"},
+		{"json", "application/json", "application/json; charset=utf-8", `{"redirect":"/new"}` + "\n"},
+		{"plain text", "text/plain", "text/plain; charset=utf-8", "/new"},
+		{"no accept", "", "text/plain; charset=utf-8", "/new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/old", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			Redirect("/new", http.StatusSeeOther).ServeHTTP(w, r)
+
+			if w.Code != http.StatusSeeOther {
+				t.Errorf("got status %d, want 303", w.Code)
+			}
+			if loc := w.Header().Get("Location"); loc != "/new" {
+				t.Errorf("got Location %q", loc)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", ct, tt.wantType)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("got body %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRedirectLocation(t *testing.T) {
+	tests := []struct {
+		target, host, url, want string
+	}{
+		{"http://example.com/a/b", "", "c", "/a/c"},
+		{"http://example.com/a/b", "", "../c?x=1", "/c?x=1"},
+		{"https://example.com/a", "", "/b", "/b"},
+		{"http://example.com/a", "", "https://other.org/b", "https://other.org/b"},
+		{"http://example.com/a", "", "//other.org/b", "//other.org/b"},
+		{"http://example.com/a", "evil.org", "/b", "/b"}, // spoofed Host
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.host != "" {
+			r.Host = tt.host
+		}
+		w := httptest.NewRecorder()
+		Redirect(tt.url, http.StatusFound).ServeHTTP(w, r)
+		if loc := w.Header().Get("Location"); loc != tt.want {
+			t.Errorf("%s: got Location %q, want %q", tt.url, loc, tt.want)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: got body %q", tt.url, w.Body.String())
+		}
+	}
+}
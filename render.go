@@ -1,8 +1,17 @@
 package render
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"sort"
+
+	"github.com/ajg/form"
 )
 
 // Renderer interface for managing response payloads.
@@ -10,18 +19,147 @@ type Renderer interface {
 	Render(w http.ResponseWriter, r *http.Request) error
 }
 
-// Binder interface for managing request payloads.
+// Binder interface for managing request payloads. The request is nil for
+// payloads bound with BindMap.
 type Binder interface {
 	Bind(r *http.Request) error
 }
 
+// PathBinder interface for populating request payloads from the request
+// path parameters, e.g. from chi's URL params. It's called by Bind after the
+// Binder, keeping the body and path binding apart.
+type PathBinder interface {
+	BindPath(r *http.Request) error
+}
+
 // Bind decodes a request body and executes the Binder method of the
-// payload structure.
+// payload structure, followed by its PathBinder and Validator methods, if
+// any.
 func Bind(r *http.Request, v Binder) error {
 	if err := Decode(r, v); err != nil {
 		return err
 	}
-	return binder(r, v)
+	return bindDecoded(r, v)
+}
+
+// StrictBind is like Bind, but decodes the request body as JSON with
+// DecodeJSONStrict, rejecting unknown fields, regardless of Decode and of the
+// request Content-Type, e.g. for sensitive admin endpoints.
+func StrictBind(r *http.Request, v Binder) error {
+	if err := DecodeJSONStrict(r.Body, v); err != nil {
+		return err
+	}
+	return bindDecoded(r, v)
+}
+
+// RelaxedBind is like Bind, but decodes the request body as JSON with
+// DecodeJSON, ignoring unknown fields, regardless of Decode and of the
+// request Content-Type, e.g. when Decode was made strict globally.
+func RelaxedBind(r *http.Request, v Binder) error {
+	if err := DecodeJSON(r.Body, v); err != nil {
+		return err
+	}
+	return bindDecoded(r, v)
+}
+
+// BindMap decodes data into v, by way of JSON, and executes its binding hooks
+// like Bind, with a nil request, e.g. to run the same validation in tests or
+// internal calls without a HTTP request. PathBinder is skipped.
+func BindMap(v Binder, data map[string]interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	return bindDecoded(nil, v)
+}
+
+// bindDecoded executes the binding hooks of a decoded payload, see Bind.
+func bindDecoded(r *http.Request, v Binder) error {
+	bindErr := binder(r, v)
+	if pb, ok := v.(PathBinder); ok && bindErr == nil && r != nil {
+		bindErr = pb.BindPath(r)
+	}
+
+	val, ok := v.(Validator)
+	if !ok {
+		return bindErr
+	}
+	validateErr := val.Validate()
+	switch {
+	case bindErr == nil:
+		return validateErr
+	case validateErr == nil:
+		return bindErr
+	default:
+		return &ValidationResult{BindError: bindErr, ValidateError: validateErr}
+	}
+}
+
+// Validator interface for validating request payloads, as provided by some
+// validation frameworks. Bind calls it after binding, even when binding
+// failed, so that all the errors can be reported at once.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationResult is the error returned by Bind when both binding and
+// validating the payload failed.
+type ValidationResult struct {
+	BindError     error
+	ValidateError error
+}
+
+func (e *ValidationResult) Error() string {
+	return e.BindError.Error() + "; " + e.ValidateError.Error()
+}
+
+// Unwrap returns both errors, for errors.Is and errors.As.
+func (e *ValidationResult) Unwrap() []error {
+	return []error{e.BindError, e.ValidateError}
+}
+
+// Is reports whether either error matches target, as errors.Is only
+// follows Unwrap() []error as of Go 1.20.
+func (e *ValidationResult) Is(target error) bool {
+	return errors.Is(e.BindError, target) || errors.Is(e.ValidateError, target)
+}
+
+// As finds the first of both errors matching target, see Is.
+func (e *ValidationResult) As(target interface{}) bool {
+	return errors.As(e.BindError, target) || errors.As(e.ValidateError, target)
+}
+
+// ErrCSRFMismatch is returned by BindForm when the CSRF token of the form is
+// missing or doesn't match the expected one.
+var ErrCSRFMismatch = errors.New("render: CSRF token mismatch")
+
+// BindForm parses an HTML form submission, checks its csrfField against
+// expectedToken, returning ErrCSRFMismatch on mismatch, decodes the other
+// form fields into v and executes its binding hooks, like Bind. Only the
+// request body is considered, not the URL query string, where tokens would
+// leak into logs and Referer headers.
+func BindForm(r *http.Request, v Binder, csrfField, expectedToken string) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	token := r.PostFormValue(csrfField)
+	if expectedToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expectedToken)) != 1 {
+		return ErrCSRFMismatch
+	}
+
+	values := url.Values{}
+	for k, vs := range r.PostForm {
+		if k != csrfField {
+			values[k] = vs
+		}
+	}
+	if err := form.DecodeValues(v, values); err != nil {
+		return err
+	}
+	return bindDecoded(r, v)
 }
 
 // Render renders a single payload and respond to the client request.
@@ -44,6 +182,168 @@ func RenderList(w http.ResponseWriter, r *http.Request, l []Renderer) error {
 	return nil
 }
 
+// RenderMap renders a map of payloads, in sorted key order, and responds to
+// the client request with them as a single object, e.g.
+// {"user": {...}, "permissions": {...}}.
+func RenderMap(w http.ResponseWriter, r *http.Request, m map[string]Renderer) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := renderer(w, r, m[k]); err != nil {
+			return err
+		}
+	}
+	Respond(w, r, m)
+	return nil
+}
+
+// OrElse returns a Renderer that renders primary, or the Renderer returned by
+// fallback if primary fails to render, e.g.
+//
+//	render.Render(w, r, render.OrElse(result, func(err error) render.Renderer {
+//		return render.NewErrResponse(http.StatusInternalServerError, err)
+//	}))
+//
+// The response is encoded from whichever of the two rendered successfully.
+func OrElse(primary Renderer, fallback func(err error) Renderer) Renderer {
+	return &orElseRenderer{primary: primary, fallback: fallback}
+}
+
+// orElseRenderer holds its renderers as plain interface{} values, so that
+// renderer() doesn't walk into them on its own.
+type orElseRenderer struct {
+	delegate
+	primary  interface{}
+	fallback func(err error) Renderer
+}
+
+func (o *orElseRenderer) Render(w http.ResponseWriter, r *http.Request) error {
+	primary := o.primary.(Renderer)
+	err := renderer(w, r, primary)
+	if err == nil {
+		o.chosen = primary
+		return nil
+	}
+	fallback := o.fallback(err)
+	if err := renderer(w, r, fallback); err != nil {
+		return err
+	}
+	o.chosen = fallback
+	return nil
+}
+
+// Conditional returns a Renderer that renders onTrue if predicate returns
+// true for the request, or onFalse otherwise, e.g. for feature flags or role
+// based responses. The response is encoded from the chosen Renderer. A panic
+// in predicate is recovered and returned as error.
+func Conditional(predicate func(r *http.Request) bool, onTrue, onFalse Renderer) Renderer {
+	return &conditionalRenderer{predicate: predicate, onTrue: onTrue, onFalse: onFalse}
+}
+
+type conditionalRenderer struct {
+	delegate
+	predicate func(r *http.Request) bool
+	onTrue    interface{}
+	onFalse   interface{}
+}
+
+func (c *conditionalRenderer) Render(w http.ResponseWriter, r *http.Request) error {
+	ok, err := c.test(r)
+	if err != nil {
+		return err
+	}
+	chosen := c.onFalse.(Renderer)
+	if ok {
+		chosen = c.onTrue.(Renderer)
+	}
+	if err := renderer(w, r, chosen); err != nil {
+		return err
+	}
+	c.chosen = chosen
+	return nil
+}
+
+func (c *conditionalRenderer) test(r *http.Request) (ok bool, err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			err = fmt.Errorf("render: conditional predicate panic: %v", rvr)
+		}
+	}()
+	return c.predicate(r), nil
+}
+
+// WithStatus returns a Renderer that sets the response status code hint
+// before rendering v, e.g.
+//
+//	render.Render(w, r, render.WithStatus(result, http.StatusCreated))
+//
+// The response is encoded from v. When nested, the innermost status wins.
+func WithStatus(v Renderer, status int) Renderer {
+	return &statusRenderer{v: v, status: status}
+}
+
+type statusRenderer struct {
+	delegate
+	v      interface{}
+	status int
+}
+
+func (s *statusRenderer) Render(w http.ResponseWriter, r *http.Request) error {
+	Status(r, s.status)
+	v := s.v.(Renderer)
+	if err := renderer(w, r, v); err != nil {
+		return err
+	}
+	s.chosen = v
+	return nil
+}
+
+// delegate is embedded by composite Renderers, to be encoded as the Renderer
+// they chose while rendering.
+type delegate struct {
+	chosen interface{}
+}
+
+func (d *delegate) wrappedValue() interface{} {
+	return d.chosen
+}
+
+// MarshalJSON and MarshalXML encode the chosen Renderer when the composite
+// one is nested in another value, e.g. in RenderList. DefaultResponder and
+// the JSON encoders of this package unwrap it beforehand, see unwrapValue,
+// so that the naming strategy and field filters apply.
+func (d *delegate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.chosen)
+}
+
+func (d *delegate) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(d.chosen)
+}
+
+// valueWrapper is implemented by Renderers encoded as another value, e.g.
+// the Renderer a composite one chose while rendering.
+type valueWrapper interface {
+	wrappedValue() interface{}
+}
+
+var valueWrapperType = reflect.TypeOf(new(valueWrapper)).Elem()
+
+// unwrapValue returns the value v is encoded as, following nested
+// valueWrappers.
+func unwrapValue(v interface{}) interface{} {
+	for {
+		vw, ok := v.(valueWrapper)
+		if !ok || reflect.ValueOf(v).IsNil() {
+			return v
+		}
+		v = vw.wrappedValue()
+	}
+}
+
 func isNil(f reflect.Value) bool {
 	switch f.Kind() {
 	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
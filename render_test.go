@@ -0,0 +1,583 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// hookedPayload records the binding hooks called on it.
+type hookedPayload struct {
+	Name string `json:"name" form:"name"`
+	ID   string `json:"-" form:"-"`
+
+	bindErr, pathErr, validateErr error
+	calls                         []string
+}
+
+func (p *hookedPayload) Bind(r *http.Request) error {
+	p.calls = append(p.calls, "Bind")
+	return p.bindErr
+}
+
+func (p *hookedPayload) BindPath(r *http.Request) error {
+	p.calls = append(p.calls, "BindPath")
+	p.ID = r.URL.Query().Get("id")
+	return p.pathErr
+}
+
+func (p *hookedPayload) Validate() error {
+	p.calls = append(p.calls, "Validate")
+	return p.validateErr
+}
+
+func formRequest(target string, values url.Values) *http.Request {
+	r := httptest.NewRequest("POST", target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestBindForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		values  url.Values
+		wantErr error
+	}{
+		{"valid token", "/", url.Values{"csrf": {"secret"}, "name": {"gopher"}}, nil},
+		{"wrong token", "/", url.Values{"csrf": {"guess"}, "name": {"gopher"}}, ErrCSRFMismatch},
+		{"missing token", "/", url.Values{"name": {"gopher"}}, ErrCSRFMismatch},
+		{"token in query", "/?csrf=secret", url.Values{"name": {"gopher"}}, ErrCSRFMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p hookedPayload
+			err := BindForm(formRequest(tt.target, tt.values), &p, "csrf", "secret")
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && p.Name != "gopher" {
+				t.Errorf("got name %q, want gopher", p.Name)
+			}
+		})
+	}
+}
+
+func TestBindFormEmptyExpectedToken(t *testing.T) {
+	var p hookedPayload
+	if err := BindForm(formRequest("/", url.Values{"csrf": {""}}), &p, "csrf", ""); err != ErrCSRFMismatch {
+		t.Errorf("got %v, want ErrCSRFMismatch", err)
+	}
+}
+
+func TestBindFormIgnoresQuery(t *testing.T) {
+	var p hookedPayload
+	r := formRequest("/?name=query", url.Values{"csrf": {"secret"}})
+	if err := BindForm(r, &p, "csrf", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "" {
+		t.Errorf("got name %q from the query string", p.Name)
+	}
+}
+
+func TestBindFormHooks(t *testing.T) {
+	validateErr := errors.New("name required")
+	p := hookedPayload{validateErr: validateErr}
+	err := BindForm(formRequest("/?id=42", url.Values{"csrf": {"secret"}}), &p, "csrf", "secret")
+	if err != validateErr {
+		t.Errorf("got %v, want the Validate error", err)
+	}
+	if got := strings.Join(p.calls, ","); got != "Bind,BindPath,Validate" {
+		t.Errorf("got hooks %s", got)
+	}
+	if p.ID != "42" {
+		t.Errorf("got ID %q from BindPath, want 42", p.ID)
+	}
+}
+
+// renderedPayload is a Renderer failing with err, if any.
+type renderedPayload struct {
+	Name string `json:"name"`
+	err  error
+}
+
+func (p *renderedPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return p.err
+}
+
+func TestOrElse(t *testing.T) {
+	errPrimary := errors.New("primary failed")
+	errFallback := errors.New("fallback failed")
+	tests := []struct {
+		name         string
+		primary      *renderedPayload
+		fallback     *renderedPayload
+		wantFallback error
+		wantErr      error
+		wantBody     string
+	}{
+		{"primary", &renderedPayload{Name: "primary"}, &renderedPayload{Name: "fallback"}, nil, nil, `{"name":"primary"}`},
+		{"fallback", &renderedPayload{Name: "primary", err: errPrimary}, &renderedPayload{Name: "fallback"}, errPrimary, nil, `{"name":"fallback"}`},
+		{"fallback error", &renderedPayload{Name: "primary", err: errPrimary}, &renderedPayload{err: errFallback}, errPrimary, errFallback, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotFallback error
+			v := OrElse(tt.primary, func(err error) Renderer {
+				gotFallback = err
+				return tt.fallback
+			})
+			w := httptest.NewRecorder()
+			err := Render(w, httptest.NewRequest("GET", "/", nil), v)
+			if err != tt.wantErr {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if gotFallback != tt.wantFallback {
+				t.Errorf("fallback called with %v, want %v", gotFallback, tt.wantFallback)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("got %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestOrElseErrResponse(t *testing.T) {
+	v := OrElse(&renderedPayload{err: errors.New("db down")}, func(err error) Renderer {
+		return NewErrResponse(http.StatusServiceUnavailable, err)
+	})
+	w := httptest.NewRecorder()
+	if err := Render(w, httptest.NewRequest("GET", "/", nil), v); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
+
+// statusPayload is a Renderer setting the response status code.
+type statusPayload struct {
+	Name   string `json:"name"`
+	status int
+}
+
+func (p *statusPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	Status(r, p.status)
+	return nil
+}
+
+func TestConditional(t *testing.T) {
+	isAdmin := func(r *http.Request) bool { return r.Header.Get("X-Role") == "admin" }
+	tests := []struct {
+		name       string
+		role       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"true", "admin", http.StatusCreated, `{"name":"admin"}`},
+		{"false", "user", http.StatusAccepted, `{"name":"user"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Role", tt.role)
+			v := Conditional(isAdmin,
+				&statusPayload{Name: "admin", status: http.StatusCreated},
+				&statusPayload{Name: "user", status: http.StatusAccepted})
+
+			w := httptest.NewRecorder()
+			if err := Render(w, r, v); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("got %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConditionalPanic(t *testing.T) {
+	v := Conditional(func(r *http.Request) bool { panic("boom") },
+		&renderedPayload{Name: "a"}, &renderedPayload{Name: "b"})
+	w := httptest.NewRecorder()
+	err := Render(w, httptest.NewRequest("GET", "/", nil), v)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("got error %v, want the recovered panic", err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("got body %q, want none", w.Body.String())
+	}
+}
+
+// orderedPayload is a Renderer appending its name to calls when rendered.
+type orderedPayload struct {
+	Name  string `json:"name"`
+	calls *[]string
+	err   error
+}
+
+func (p *orderedPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	*p.calls = append(*p.calls, p.Name)
+	return p.err
+}
+
+func TestRenderMap(t *testing.T) {
+	var calls []string
+	m := map[string]Renderer{}
+	for _, k := range []string{"e", "c", "a", "d", "b"} {
+		m[k] = &orderedPayload{Name: k, calls: &calls}
+	}
+	w := httptest.NewRecorder()
+	if err := RenderMap(w, httptest.NewRequest("GET", "/", nil), m); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "a,b,c,d,e" {
+		t.Errorf("got Render calls %s, want a,b,c,d,e", got)
+	}
+	want := `{"a":{"name":"a"},"b":{"name":"b"},"c":{"name":"c"},"d":{"name":"d"},"e":{"name":"e"}}`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRenderMapError(t *testing.T) {
+	errRender := errors.New("render failed")
+	var calls []string
+	m := map[string]Renderer{}
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		m[k] = &orderedPayload{Name: k, calls: &calls}
+	}
+	m["c"].(*orderedPayload).err = errRender
+
+	w := httptest.NewRecorder()
+	if err := RenderMap(w, httptest.NewRequest("GET", "/", nil), m); err != errRender {
+		t.Errorf("got error %v, want %v", err, errRender)
+	}
+	if got := strings.Join(calls, ","); got != "a,b,c" {
+		t.Errorf("got Render calls %s, want a,b,c", got)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("got body %q, want none", w.Body.String())
+	}
+}
+
+// statusSeenPayload is a Renderer recording the status hint set when it's
+// rendered.
+type statusSeenPayload struct {
+	Name string `json:"name"`
+	seen int
+}
+
+func (p *statusSeenPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	p.seen, _ = r.Context().Value(StatusCtxKey).(int)
+	return nil
+}
+
+func TestWithStatus(t *testing.T) {
+	v := &statusSeenPayload{Name: "a"}
+	w := httptest.NewRecorder()
+	if err := Render(w, httptest.NewRequest("POST", "/", nil), WithStatus(v, http.StatusCreated)); err != nil {
+		t.Fatal(err)
+	}
+	if v.seen != http.StatusCreated {
+		t.Errorf("inner renderer saw status %d, want 201", v.seen)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("got status %d, want 201", w.Code)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"name":"a"}` {
+		t.Errorf("got %s, want the inner renderer", got)
+	}
+}
+
+func TestWithStatusNested(t *testing.T) {
+	v := WithStatus(WithStatus(&statusSeenPayload{Name: "a"}, http.StatusAccepted), http.StatusCreated)
+	w := httptest.NewRecorder()
+	if err := Render(w, httptest.NewRequest("POST", "/", nil), v); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want the innermost 202", w.Code)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"name":"a"}` {
+		t.Errorf("got %s, want the inner renderer", got)
+	}
+}
+
+// secretPayload is a Renderer with a field to filter out.
+type secretPayload struct {
+	UserID     int
+	InternalID string `json:"internal_id"`
+}
+
+func (p *secretPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TestCompositeRenderersEncoding checks that composite Renderers are encoded
+// as the Renderer they chose, as per the package settings.
+func TestCompositeRenderersEncoding(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+
+	composites := map[string]func(v Renderer) Renderer{
+		"with status": func(v Renderer) Renderer { return WithStatus(v, http.StatusCreated) },
+		"or else":     func(v Renderer) Renderer { return OrElse(v, nil) },
+		"conditional": func(v Renderer) Renderer {
+			return Conditional(func(*http.Request) bool { return true }, v, v)
+		},
+		"nested": func(v Renderer) Renderer { return WithStatus(OrElse(v, nil), http.StatusCreated) },
+	}
+	for name, composite := range composites {
+		t.Run(name, func(t *testing.T) {
+			SetJSONNamingStrategy(nil)
+			r := OmitFields(httptest.NewRequest("GET", "/", nil), "internal_id")
+			w := httptest.NewRecorder()
+			if err := Render(w, r, composite(&secretPayload{1, "SECRET"})); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != `{"UserID":1}` {
+				t.Errorf("filtered: got %s", got)
+			}
+
+			w = httptest.NewRecorder()
+			l := []Renderer{composite(&secretPayload{1, "SECRET"})}
+			if err := RenderList(w, r, l); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != `[{"UserID":1}]` {
+				t.Errorf("filtered list: got %s", got)
+			}
+
+			SetJSONNamingStrategy(SnakeCaseNamer)
+			w = httptest.NewRecorder()
+			if err := Render(w, httptest.NewRequest("GET", "/", nil), composite(&secretPayload{1, "x"})); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != `{"user_id":1,"internal_id":"x"}` {
+				t.Errorf("snake case: got %s", got)
+			}
+		})
+	}
+}
+
+func TestCompositeRenderersOnSuccess(t *testing.T) {
+	defer func(prev func(http.ResponseWriter, *http.Request, interface{})) { OnSuccess = prev }(OnSuccess)
+	var got interface{}
+	OnSuccess = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		got = v
+	}
+
+	v := &secretPayload{UserID: 1}
+	if err := Render(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), WithStatus(v, http.StatusCreated)); err != nil {
+		t.Fatal(err)
+	}
+	if got != v {
+		t.Errorf("OnSuccess got %#v, want the chosen renderer", got)
+	}
+}
+
+// pathPayload reads its ID from the request path, like a chi handler reads
+// its URL params, without http.Request.PathValue, which only exists as of Go
+// 1.22.
+type pathPayload struct {
+	Name string `json:"name"`
+	ID   string `json:"-"`
+
+	bindErr, pathErr error
+	calls            []string
+}
+
+func (p *pathPayload) Bind(r *http.Request) error {
+	p.calls = append(p.calls, "Bind")
+	return p.bindErr
+}
+
+func (p *pathPayload) BindPath(r *http.Request) error {
+	p.calls = append(p.calls, "BindPath")
+	p.ID = strings.TrimPrefix(r.URL.Path, "/users/")
+	return p.pathErr
+}
+
+func TestBindPath(t *testing.T) {
+	errBind := errors.New("name required")
+	errPath := errors.New("invalid id")
+	tests := []struct {
+		name      string
+		p         pathPayload
+		wantErr   error
+		wantCalls string
+		wantID    string
+	}{
+		{"ok", pathPayload{}, nil, "Bind,BindPath", "42"},
+		{"bind error", pathPayload{bindErr: errBind}, errBind, "Bind", ""},
+		{"path error", pathPayload{pathErr: errPath}, errPath, "Bind,BindPath", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/users/42", strings.NewReader(`{"name":"gopher"}`))
+			r.Header.Set("Content-Type", "application/json")
+
+			p := tt.p
+			if err := Bind(r, &p); err != tt.wantErr {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := strings.Join(p.calls, ","); got != tt.wantCalls {
+				t.Errorf("got hooks %s, want %s", got, tt.wantCalls)
+			}
+			if p.ID != tt.wantID || p.Name != "gopher" {
+				t.Errorf("got %+v, want name gopher and ID %q", p, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestBindValidator(t *testing.T) {
+	errBind := errors.New("bind failed")
+	errValidate := errors.New("name required")
+	tests := []struct {
+		name      string
+		p         hookedPayload
+		wantCalls string
+		wantBind  error
+		wantValid error
+	}{
+		{"ok", hookedPayload{}, "Bind,BindPath,Validate", nil, nil},
+		{"validate error", hookedPayload{validateErr: errValidate}, "Bind,BindPath,Validate", nil, errValidate},
+		{"bind error", hookedPayload{bindErr: errBind}, "Bind,Validate", errBind, nil},
+		{"both", hookedPayload{bindErr: errBind, validateErr: errValidate}, "Bind,Validate", errBind, errValidate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+			r.Header.Set("Content-Type", "application/json")
+			p := tt.p
+			err := Bind(r, &p)
+			if got := strings.Join(p.calls, ","); got != tt.wantCalls {
+				t.Errorf("got hooks %s, want %s", got, tt.wantCalls)
+			}
+			for _, want := range []error{tt.wantBind, tt.wantValid} {
+				if want != nil && !errors.Is(err, want) {
+					t.Errorf("got error %v, want it to wrap %v", err, want)
+				}
+			}
+			if tt.wantBind == nil && tt.wantValid == nil && err != nil {
+				t.Errorf("got error %v", err)
+			}
+
+			var result *ValidationResult
+			if isBoth := tt.wantBind != nil && tt.wantValid != nil; errors.As(err, &result) != isBoth {
+				t.Errorf("got %T, want a *ValidationResult only when both hooks fail", err)
+			} else if isBoth && (result.BindError != errBind || result.ValidateError != errValidate) {
+				t.Errorf("got %+v", result)
+			}
+		})
+	}
+}
+
+// TestValidationResultIsAs checks the Is and As methods on their own, as
+// errors.Is and errors.As use Unwrap() []error too as of Go 1.20.
+func TestValidationResultIsAs(t *testing.T) {
+	errBind := errors.New("bind failed")
+	validateErr := &fieldsError{Code: "E1", Message: "name required"}
+	result := &ValidationResult{BindError: fmt.Errorf("decoding: %w", errBind), ValidateError: validateErr}
+
+	if !result.Is(errBind) {
+		t.Error("Is: got false for the bind error")
+	}
+	if result.Is(errors.New("other")) {
+		t.Error("Is: got true for another error")
+	}
+	var fe *fieldsError
+	if !result.As(&fe) || fe != validateErr {
+		t.Errorf("As: got %v, want the validate error", fe)
+	}
+	var nf notFoundError
+	if result.As(&nf) {
+		t.Error("As: got true for another error type")
+	}
+}
+
+func TestStrictAndRelaxedBind(t *testing.T) {
+	defer func(prev func(r *http.Request, v interface{}) error) { Decode = prev }(Decode)
+	strict := func(r *http.Request, v interface{}) error { return DecodeJSONStrict(r.Body, v) }
+	relaxed := func(r *http.Request, v interface{}) error { return DecodeJSON(r.Body, v) }
+
+	tests := []struct {
+		name    string
+		decode  func(r *http.Request, v interface{}) error
+		bind    func(r *http.Request, v Binder) error
+		wantErr bool
+	}{
+		{"strict over relaxed default", relaxed, StrictBind, true},
+		{"strict over strict default", strict, StrictBind, true},
+		{"relaxed over strict default", strict, RelaxedBind, false},
+		{"relaxed over relaxed default", relaxed, RelaxedBind, false},
+		{"bind with strict default", strict, Bind, true},
+		{"bind with relaxed default", relaxed, Bind, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Decode = tt.decode
+			// The Content-Type is irrelevant to StrictBind and RelaxedBind.
+			r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher","admin":true}`))
+			r.Header.Set("Content-Type", "text/plain")
+
+			p := hookedPayload{}
+			err := tt.bind(r, &p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Name != "gopher" || len(p.calls) == 0) {
+				t.Errorf("got %+v, want the payload bound", p)
+			}
+		})
+	}
+}
+
+func TestBindMap(t *testing.T) {
+	data := map[string]interface{}{"name": "gopher"}
+
+	var fromMap hookedPayload
+	if err := BindMap(&fromMap, data); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+	r.Header.Set("Content-Type", "application/json")
+	var fromRequest hookedPayload
+	if err := Bind(r, &fromRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	if fromMap.Name != fromRequest.Name {
+		t.Errorf("got name %q, want %q", fromMap.Name, fromRequest.Name)
+	}
+	// PathBinder is skipped without a request.
+	if got := strings.Join(fromMap.calls, ","); got != "Bind,Validate" {
+		t.Errorf("got hooks %s, want Bind,Validate", got)
+	}
+}
+
+func TestBindMapErrors(t *testing.T) {
+	errValidate := errors.New("name required")
+	p := hookedPayload{validateErr: errValidate}
+	if err := BindMap(&p, map[string]interface{}{}); err != errValidate {
+		t.Errorf("got %v, want the Validate error", err)
+	}
+	if err := BindMap(&hookedPayload{}, map[string]interface{}{"name": 1}); err == nil {
+		t.Error("got no error for a mistyped field")
+	}
+	if err := BindMap(&hookedPayload{}, map[string]interface{}{"name": make(chan int)}); err == nil {
+		t.Error("got no error for an unencodable value")
+	}
+}
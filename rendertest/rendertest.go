@@ -0,0 +1,34 @@
+// Package rendertest provides helpers for testing handlers and payloads built
+// with the render package.
+package rendertest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+// MustBind is like render.Bind, but panics if the request payload can't be
+// decoded or bound into v.
+func MustBind(r *http.Request, v render.Binder) {
+	if err := render.Bind(r, v); err != nil {
+		panic(fmt.Sprintf("rendertest: bind %T: %v", v, err))
+	}
+}
+
+// MustDecode is like render.Decode, but panics if the request payload can't
+// be decoded into v.
+func MustDecode(r *http.Request, v interface{}) {
+	if err := render.Decode(r, v); err != nil {
+		panic(fmt.Sprintf("rendertest: decode %T: %v", v, err))
+	}
+}
+
+// WithAccept returns a shallow copy of r with the accepted content type
+// forced to ct, as done by the render.SetContentType middleware, so that
+// content negotiation can be tested without setting Accept headers.
+func WithAccept(r *http.Request, ct render.ContentType) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), render.ContentTypeCtxKey, ct))
+}
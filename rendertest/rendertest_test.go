@@ -0,0 +1,79 @@
+package rendertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/render"
+)
+
+type payload struct {
+	Name string `json:"name"`
+}
+
+func (p *payload) Bind(r *http.Request) error { return nil }
+
+func jsonRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func recoverMessage(fn func()) (msg interface{}) {
+	defer func() { msg = recover() }()
+	fn()
+	return nil
+}
+
+func TestMustBind(t *testing.T) {
+	var p payload
+	if msg := recoverMessage(func() { MustBind(jsonRequest(`{"name":"gopher"}`), &p) }); msg != nil {
+		t.Fatalf("panicked: %v", msg)
+	}
+	if p.Name != "gopher" {
+		t.Errorf("got %q, want gopher", p.Name)
+	}
+
+	msg := recoverMessage(func() { MustBind(jsonRequest(`{`), &p) })
+	s, ok := msg.(string)
+	if !ok || !strings.HasPrefix(s, "rendertest: bind *rendertest.payload: ") {
+		t.Errorf("got panic %#v", msg)
+	}
+}
+
+func TestMustDecode(t *testing.T) {
+	var m map[string]string
+	if msg := recoverMessage(func() { MustDecode(jsonRequest(`{"name":"gopher"}`), &m) }); msg != nil {
+		t.Fatalf("panicked: %v", msg)
+	}
+	if m["name"] != "gopher" {
+		t.Errorf("got %v", m)
+	}
+
+	msg := recoverMessage(func() { MustDecode(jsonRequest(`[`), &m) })
+	s, ok := msg.(string)
+	if !ok || !strings.HasPrefix(s, "rendertest: decode *map[string]string: ") {
+		t.Errorf("got panic %#v", msg)
+	}
+}
+
+func TestWithAccept(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	r2 := WithAccept(r, render.ContentTypeXML)
+
+	if got := render.AcceptedContentType(r2); got != render.ContentTypeXML {
+		t.Errorf("got %v, want %v", got, render.ContentTypeXML)
+	}
+	if got := render.AcceptedContentType(r); got != render.ContentTypeJSON {
+		t.Errorf("original request: got %v, want %v", got, render.ContentTypeJSON)
+	}
+
+	w := httptest.NewRecorder()
+	render.Respond(w, r2, &payload{Name: "gopher"})
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
@@ -0,0 +1,49 @@
+package render
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// RequestIDCtxKey is a context key to record the request correlation ID.
+var RequestIDCtxKey = &contextKey{"RequestID"}
+
+// RequestIDHeader is the header carrying request correlation IDs.
+var RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that reads the request correlation ID from the
+// X-Request-ID request header, or generates a random UUID if absent, stores
+// it in the request context and sets it on the response. Errors reported to
+// OnError are prefixed with the ID.
+func RequestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newUUID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), RequestIDCtxKey, id))
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// GetRequestID returns the request correlation ID set by the RequestID
+// middleware, or an empty string.
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(RequestIDCtxKey).(string)
+	return id
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("render: generating request ID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
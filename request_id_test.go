@@ -0,0 +1,67 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{"preserved", "req-42"},
+		{"generated", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetRequestID(r)
+			})).ServeHTTP(w, r)
+
+			if tt.incoming != "" && got != tt.incoming {
+				t.Errorf("got ID %q, want %q", got, tt.incoming)
+			}
+			if tt.incoming == "" && !uuidPattern.MatchString(got) {
+				t.Errorf("got ID %q, want a UUID v4", got)
+			}
+			if header := w.Header().Get("X-Request-ID"); header != got {
+				t.Errorf("got header %q, want %q", header, got)
+			}
+		})
+	}
+
+	if id := GetRequestID(httptest.NewRequest("GET", "/", nil)); id != "" {
+		t.Errorf("got ID %q outside of the middleware", id)
+	}
+	if a, b := newUUID(), newUUID(); a == b {
+		t.Errorf("got the same ID twice: %s", a)
+	}
+}
+
+func TestRequestIDReportedErrors(t *testing.T) {
+	var errs []error
+	defer captureErrors(&errs)()
+	errTest := errors.New("boom")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-ID", "req-42")
+	RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reportError(r, errTest)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(errs) != 1 || errs[0].Error() != "request req-42: boom" || !errors.Is(errs[0], errTest) {
+		t.Errorf("got errors %v", errs)
+	}
+}
@@ -2,12 +2,20 @@ package render
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajg/form"
 )
 
 // M is a convenience alias for quickly building a map structure that is going
@@ -22,6 +30,18 @@ type M map[string]interface{}
 // differently, or log something before you respond.
 var Respond = DefaultResponder
 
+// OnSuccess, if set, is called by DefaultResponder once the response value
+// has been encoded successfully, e.g. for auditing or metrics. It receives the
+// value passed to Respond, not the encoded bytes. It's not called for error
+// values, nor for responses of Encoders, such as the ones set with
+// WithEncoder, with a status code of 400 or above.
+var OnSuccess func(w http.ResponseWriter, r *http.Request, v interface{})
+
+// TransformResponse, if set, is called by DefaultResponder with each
+// response value, e.g. to wrap it into an envelope. The returned value is
+// encoded instead, whatever the content type. Note v may be nil.
+var TransformResponse func(v interface{}) interface{}
+
 // StatusCtxKey is a context key to record a future HTTP response status code.
 var StatusCtxKey = &contextKey{"Status"}
 
@@ -32,13 +52,261 @@ func Status(r *http.Request, status int) {
 	*r = *r.WithContext(context.WithValue(r.Context(), StatusCtxKey, status))
 }
 
+// WriteHeader writes the response header with the status code hint set with
+// Status, defaulting to 200 OK, for handlers that need to flush the header
+// before responding.
+func WriteHeader(w http.ResponseWriter, r *http.Request) {
+	status, ok := r.Context().Value(StatusCtxKey).(int)
+	if !ok {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+// writeHeader writes the response header with the status code hint, if any,
+// leaving it up to net/http otherwise.
+func writeHeader(w http.ResponseWriter, r *http.Request) {
+	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+}
+
+// RespondStatus sets the response status code hint and responds with v, as a
+// shorthand for Status followed by Respond, in the right order.
+func RespondStatus(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	Status(r, status)
+	Respond(w, r, v)
+}
+
+// JSONStatus is a shorthand for Status followed by JSON.
+func JSONStatus(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	Status(r, status)
+	JSON(w, r, v)
+}
+
+// XMLStatus is a shorthand for Status followed by XML.
+func XMLStatus(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	Status(r, status)
+	XML(w, r, v)
+}
+
+// RenderToBytes responds with v as per Respond, without an actual client
+// connection, e.g. for caching or tests, returning the response body and its
+// Content-Type. Renderers, hooks and the status code hint apply as usual; a
+// response status of 400 or above is reported as an error, along with the
+// body and Content-Type. r itself is left untouched.
+func RenderToBytes(r *http.Request, v interface{}) ([]byte, string, error) {
+	r = r.WithContext(r.Context())
+	w := newBufferWriter()
+	if rv, ok := v.(Renderer); ok {
+		if err := renderer(w, r, rv); err != nil {
+			return nil, "", err
+		}
+	}
+	Respond(w, r, v)
+
+	var err error
+	if status := w.Status(); status >= http.StatusBadRequest {
+		err = fmt.Errorf("render: response status %d", status)
+	}
+	return w.body.Bytes(), w.header.Get("Content-Type"), err
+}
+
+// Encoder encodes a value into the response, setting its Content-Type, e.g.
+// JSON or XML. Encoders wrapping writers that must be closed to flush their
+// final bytes, e.g. gzip, close them before returning, handling close errors
+// like any other encoding error, see NewCompressedXMLEncoder, or are written
+// as a CloseableEncoder.
+type Encoder func(w http.ResponseWriter, r *http.Request, v interface{})
+
+// CloseableEncoder is an encoder with a lifecycle, e.g. one streaming the
+// response through a gzip or multipart writer which must be closed to write
+// its final bytes. DefaultResponder calls Close exactly once after Encode,
+// even if Encode failed. Encode errors are responded to like the ones of the
+// built-in encoders, while Close errors, which occur once the response is
+// written, are reported to OnError. As Close ends its lifecycle, use a fresh
+// CloseableEncoder for each request, see WithCloseableEncoder.
+type CloseableEncoder interface {
+	Encode(w http.ResponseWriter, r *http.Request, v interface{}) error
+	Close() error
+}
+
+// Compile-time checks that the responders can be used as Encoders.
+var (
+	_ Encoder = JSON
+	_ Encoder = XML
+	_ Encoder = Form
+	_ Encoder = JSONC
+	_ Encoder = SafeJSON
+	_ Encoder = ProblemJSON
+	_ Encoder = ProblemXML
+	_ Encoder = GRPCWebJSON
+	_ Encoder = GRPCWebProto
+)
+
+// EncoderCtxKey is a context key to record an Encoder, or a
+// CloseableEncoder, overriding the Accept header based encoder selection.
+var EncoderCtxKey = &contextKey{"Encoder"}
+
+// WithEncoder returns a shallow copy of r with enc stored in its context.
+// DefaultResponder will use enc to encode the response, regardless of the
+// request Accept header.
+func WithEncoder(r *http.Request, enc Encoder) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), EncoderCtxKey, enc))
+}
+
+// WithCloseableEncoder is like WithEncoder, for a CloseableEncoder.
+func WithCloseableEncoder(r *http.Request, enc CloseableEncoder) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), EncoderCtxKey, enc))
+}
+
+// UseEncoder is a middleware that forces the response Encoder, see
+// WithEncoder.
+func UseEncoder(enc Encoder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, WithEncoder(r, enc))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// MultiEncoder returns an Encoder trying each of encoders in order, using the
+// response of the first one succeeding, e.g. not failing with a 5xx status
+// code, as Encoders report their errors in the response. Each attempt is
+// buffered, so that failures don't leave partial writes behind. If all of
+// them fail, the response of the last one is sent.
+func MultiEncoder(encoders ...Encoder) Encoder {
+	return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		var bw *bufferWriter
+		for _, enc := range encoders {
+			bw = newBufferWriter()
+			enc(bw, r, v)
+			if bw.Status() < http.StatusInternalServerError {
+				break
+			}
+		}
+		if bw == nil {
+			http.Error(w, "render: no encoder", http.StatusInternalServerError)
+			return
+		}
+		bw.writeTo(w, bw.body.Bytes())
+	}
+}
+
+// Encode writes 'v' to w, encoded as the given content type exactly as the
+// responders encode response bodies, e.g. to test encoding without a HTTP
+// server. Encoding failures are returned as errors.
+func Encode(w io.Writer, contentType ContentType, v interface{}) error {
+	enc, ok := encoderFor(contentType)
+	if !ok {
+		return fmt.Errorf("render: unable to encode content type %q", contentType)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/", nil) // can't fail
+	bw := newBufferWriter()
+	enc(bw, r, v)
+	if bw.Status() >= http.StatusBadRequest {
+		return fmt.Errorf("render: %s", strings.TrimSpace(bw.body.String()))
+	}
+	_, err := w.Write(bw.body.Bytes())
+	return err
+}
+
+// encoderFor returns the Encoder of the given content type: the one of the
+// Codec registered for it, if any, or the built-in one.
+func encoderFor(ct ContentType) (Encoder, bool) {
+	if c, ok := LookupCodec(ct); ok && c.Encoder != nil {
+		return c.Encoder, true
+	}
+
+	switch ct {
+	case ContentTypeJSON:
+		return JSON, true
+	case ContentTypeXML:
+		return XML, true
+	case ContentTypeForm:
+		return Form, true
+	case ContentTypeJSONC:
+		return JSONC, true
+	case ContentTypeGRPCWebJSON:
+		return GRPCWebJSON, true
+	case ContentTypeGRPCWebProto:
+		return GRPCWebProto, true
+	case ContentTypePlainText:
+		return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+			PlainText(w, r, fmt.Sprint(v))
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// StrictNegotiation makes DefaultResponder respond with 406 Not Acceptable,
+// as per ContentNegotiationError, to requests not accepting any of the
+// content types it encodes, rather than falling back to JSON. Requests
+// without an Accept header still get JSON.
+var StrictNegotiation = false
+
+// ContentNegotiationError responds with 406 Not Acceptable, listing the
+// supported content types as JSON, e.g. {"supported":["application/json"]}.
+func ContentNegotiationError(w http.ResponseWriter, r *http.Request, supported ...ContentType) {
+	types := make([]string, 0, len(supported))
+	for _, ct := range supported {
+		types = append(types, ct.String())
+	}
+	Status(r, http.StatusNotAcceptable)
+	JSON(w, r, M{"supported": types})
+}
+
+// responderContentTypes are the content types DefaultResponder encodes, in
+// order of preference for equally acceptable ones.
+var responderContentTypes = []ContentType{
+	ContentTypeJSON,
+	ContentTypeXML,
+	ContentTypeForm,
+	ContentTypeJSONC,
+	ContentTypeGRPCWebJSON,
+	ContentTypeGRPCWebProto,
+}
+
+// filteredContentTypes are the content types of responderContentTypes
+// DefaultResponder encodes applying field filters, see OmitFields.
+var filteredContentTypes = []ContentType{
+	ContentTypeJSON,
+	ContentTypeJSONC,
+	ContentTypeGRPCWebJSON,
+}
+
+func containsContentType(contentTypes []ContentType, ct ContentType) bool {
+	for _, c := range contentTypes {
+		if c == ct {
+			return true
+		}
+	}
+	return false
+}
+
 // Respond handles streaming JSON and XML responses, automatically setting the
-// Content-Type based on request headers. It will default to a JSON response.
+// Content-Type based on request headers, as per Negotiate, so that less
+// preferred but supported types of the Accept header are picked over
+// unsupported ones. Requests accepting JSON only through a wildcard, such as
+// the "*/*" of browsers, get JSON though, whatever other types they list. It
+// will default to a JSON response, unless StrictNegotiation is set, and falls
+// back to JSON, if acceptable, when the negotiated type can't encode the
+// value, e.g. a map as XML.
+// Error values without exported fields, e.g. the ones of errors.New or
+// fmt.Errorf, are responded to as per RenderError, unless they are Renderers.
+// Composite Renderers, e.g. the ones of WithStatus or OrElse, are responded
+// with as the Renderer they chose.
 func DefaultResponder(w http.ResponseWriter, r *http.Request, v interface{}) {
+	v = unwrapValue(v)
+	orig := v
+
 	if v != nil {
 		switch reflect.TypeOf(v).Kind() {
 		case reflect.Chan:
-			switch GetAcceptedContentType(r) {
+			switch AcceptedContentType(r) {
 			case ContentTypeEventStream:
 				channelEventStream(w, r, v)
 				return
@@ -48,95 +316,747 @@ func DefaultResponder(w http.ResponseWriter, r *http.Request, v interface{}) {
 		}
 	}
 
-	// Format response based on request Accept header.
-	switch GetAcceptedContentType(r) {
+	// Errors without exported fields would be encoded as {}, render them as
+	// ErrResponse unless they know how to render themselves.
+	if err, ok := v.(error); ok && !hasExportedFields(v) {
+		if _, ok := v.(Renderer); !ok {
+			e := toErrResponse(err)
+			renderer(w, r, e) //nolint:errcheck
+			v = e
+		}
+	}
+
+	if TransformResponse != nil {
+		v = TransformResponse(v)
+	}
+
+	switch enc := r.Context().Value(EncoderCtxKey).(type) {
+	case Encoder:
+		encodeWith(w, r, enc, v, orig)
+		return
+	case CloseableEncoder:
+		encodeClosing(w, r, enc, v, orig)
+		return
+	}
+
+	// Format response based on request Accept header, picking the most
+	// acceptable content type we can encode.
+	// Only the JSON encoders apply field filters, so that the fields they
+	// leave out can't leak through another content type.
+	supported := responderContentTypes
+	filtered := getFieldFilter(r) != nil
+	if filtered {
+		supported = filteredContentTypes
+	}
+	ct, ok := negotiateResponse(r, supported)
+	if filtered && !containsContentType(supported, ct) {
+		ct = ContentTypeJSON // forced with SetContentType
+	}
+	if !ok && StrictNegotiation && r.Header.Get("Accept") != "" {
+		ContentNegotiationError(w, r, supported...)
+		return
+	}
+	if c, ok := LookupCodec(ct); ok && c.Encoder != nil && !filtered {
+		encodeWith(w, r, c.Encoder, v, orig)
+		return
+	}
+	var err error
+	switch ct {
 	case ContentTypeJSON:
-		JSON(w, r, v)
+		err = encodeJSON(w, r, v)
 	case ContentTypeXML:
-		XML(w, r, v)
+		err = encodeXML(w, r, v)
+	case ContentTypeForm:
+		err = encodeForm(w, r, v)
+	case ContentTypeJSONC:
+		err = encodeJSONC(w, r, v)
+	case ContentTypeGRPCWebJSON:
+		err = encodeGRPCWebJSON(w, r, v)
+	case ContentTypeGRPCWebProto:
+		err = encodeGRPCWebProto(w, r, v)
 	default:
-		JSON(w, r, v)
+		err = encodeJSON(w, r, v)
+	}
+	if err != nil && ct != ContentTypeJSON && canceled(r) == nil && acceptsJSON(r) {
+		// The encoders fail before writing anything, JSON can still be sent.
+		err = encodeJSON(w, r, v)
+	}
+	if err != nil {
+		encodeError(w, r, err)
+		return
+	}
+
+	if _, isErr := orig.(error); !isErr && OnSuccess != nil {
+		OnSuccess(w, r, orig)
+	}
+}
+
+// hasExportedFields reports whether v has anything to encode: it's not a
+// struct, or a pointer to one, without exported fields nor marshalling
+// methods.
+func hasExportedFields(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if implementsMarshaler(rv) {
+		return true
+	}
+	if _, ok := v.(xml.Marshaler); ok {
+		return true
+	}
+	t := rv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() != reflect.Struct || len(jsonFields(t, nil)) > 0
+}
+
+// encodeWith encodes v with enc, calling OnSuccess with orig unless orig is an
+// error or enc responded with an error status, as Encoders report their
+// errors in the response.
+func encodeWith(w http.ResponseWriter, r *http.Request, enc Encoder, v, orig interface{}) {
+	if _, isErr := orig.(error); isErr || OnSuccess == nil {
+		enc(w, r, v)
+		return
+	}
+
+	status := http.StatusOK
+	ww := &hookWriter{ResponseWriter: w, beforeHeader: func(_ http.ResponseWriter, code int) {
+		status = code
+	}}
+	enc(ww, r, v)
+	if status < http.StatusBadRequest {
+		OnSuccess(w, r, orig)
+	}
+}
+
+// encodeClosing encodes v with a CloseableEncoder, see encodeWith.
+func encodeClosing(w http.ResponseWriter, r *http.Request, enc CloseableEncoder, v, orig interface{}) {
+	status := http.StatusOK
+	ww := &hookWriter{ResponseWriter: w, beforeHeader: func(_ http.ResponseWriter, code int) {
+		status = code
+	}}
+	err := enc.Encode(ww, r, v)
+	if err != nil {
+		encodeError(ww, r, err)
+	}
+	if closeErr := enc.Close(); closeErr != nil {
+		reportError(r, fmt.Errorf("render: closing encoder: %w", closeErr))
+		return
+	}
+
+	if _, isErr := orig.(error); isErr || OnSuccess == nil || err != nil {
+		return
+	}
+	if status < http.StatusBadRequest {
+		OnSuccess(w, r, orig)
 	}
 }
 
 // PlainText writes a string to the response, setting the Content-Type as
 // text/plain.
 func PlainText(w http.ResponseWriter, r *http.Request, v string) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
-	}
-	w.Write([]byte(v)) //nolint:errcheck
+	w.Header().Set("Content-Type", contentType("text/plain"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset([]byte(v))) //nolint:errcheck
+}
+
+// WriteString writes s to the response as plain text, see PlainText.
+func WriteString(w http.ResponseWriter, r *http.Request, s string) {
+	PlainText(w, r, s)
+}
+
+// WriteStringf writes a formatted string to the response as plain text, see
+// PlainText.
+func WriteStringf(w http.ResponseWriter, r *http.Request, format string, args ...interface{}) {
+	PlainText(w, r, fmt.Sprintf(format, args...))
+}
+
+// WriteBytes writes raw bytes to the response, see Data.
+func WriteBytes(w http.ResponseWriter, r *http.Request, data []byte) {
+	Data(w, r, data)
 }
 
 // Data writes raw bytes to the response, setting the Content-Type as
 // application/octet-stream.
 func Data(w http.ResponseWriter, r *http.Request, v []byte) {
 	w.Header().Set("Content-Type", "application/octet-stream")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
+	if encoding := contentEncoding(r); encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
 	}
+	applyHeaders(w, r)
+	writeHeader(w, r)
 	w.Write(v) //nolint:errcheck
 }
 
+// ContentEncodingCtxKey is a context key to record the Content-Encoding of
+// pre-compressed response bodies.
+var ContentEncodingCtxKey = &contextKey{"ContentEncoding"}
+
+// SetContentEncoding returns a shallow copy of r for which responses are
+// sent with the given Content-Encoding, e.g. "gzip", for bodies compressed
+// already, such as assets stored compressed. It applies to Data, and to
+// RawJSON and json.RawMessage values for pre-compressed JSON, which are then
+// written as is; other responses are left alone.
+func SetContentEncoding(r *http.Request, encoding string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ContentEncodingCtxKey, encoding))
+}
+
+func contentEncoding(r *http.Request) string {
+	encoding, _ := r.Context().Value(ContentEncodingCtxKey).(string)
+	return encoding
+}
+
 // HTML writes a string to the response, setting the Content-Type as text/html.
 func HTML(w http.ResponseWriter, r *http.Request, v string) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
+	w.Header().Set("Content-Type", contentType("text/html"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset([]byte(v))) //nolint:errcheck
+}
+
+// DeterministicJSON makes JSON sort the keys of all objects, recursively,
+// including the ones produced by custom json.Marshaler implementations and
+// structs, so that equivalent values always encode to identical bytes, e.g.
+// for ETags or response comparison in tests.
+var DeterministicJSON = false
+
+// OmitNullJSON makes JSON leave out object members with a null value,
+// recursively, e.g. nil pointer fields, without tagging every field with
+// omitempty. Null array elements, and a null document, are kept as is.
+var OmitNullJSON = false
+
+// omitJSONNulls re-encodes the JSON document in buf without null object
+// members, preserving the order of keys and numbers as is.
+func omitJSONNulls(buf *bytes.Buffer) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+		n         int
 	}
-	w.Write([]byte(v)) //nolint:errcheck
+	var (
+		stack []*frame
+		key   []byte
+		out   bytes.Buffer
+	)
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.UseNumber()
+
+	// prefix writes the separator, and key, preceding a value.
+	prefix := func() {
+		if len(stack) == 0 {
+			return
+		}
+		f := stack[len(stack)-1]
+		if f.n > 0 {
+			out.WriteByte(',')
+		}
+		f.n++
+		if f.object {
+			out.Write(key)
+			out.WriteByte(':')
+			f.expectKey = true
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && top.object && top.expectKey {
+			if k, ok := tok.(string); ok {
+				if key, err = json.Marshal(k); err != nil {
+					return err
+				}
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{', '[':
+				prefix()
+				out.WriteRune(rune(tok))
+				stack = append(stack, &frame{object: tok == '{', expectKey: tok == '{'})
+			default:
+				out.WriteRune(rune(tok))
+				stack = stack[:len(stack)-1]
+			}
+		case nil:
+			if top != nil && top.object {
+				top.expectKey = true // left out
+				continue
+			}
+			prefix()
+			out.WriteString("null")
+		default:
+			b, err := json.Marshal(tok)
+			if err != nil {
+				return err
+			}
+			prefix()
+			out.Write(b)
+		}
+	}
+
+	out.WriteByte('\n')
+	buf.Reset()
+	buf.Write(out.Bytes())
+	return nil
+}
+
+// canonicalizeJSON re-encodes the JSON document in buf with sorted object
+// keys, preserving numbers as is.
+func canonicalizeJSON(buf *bytes.Buffer) error {
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	buf.Reset()
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(true)
+	return enc.Encode(v)
 }
 
 // JSON marshals 'v' to JSON, automatically escaping HTML and setting the
-// Content-Type as application/json.
+// Content-Type as application/json. Struct field names are mapped according
+// to SetJSONNamingStrategy, if set, and fields are filtered as per OmitFields
+// and IncludeOnlyFields. Keys of maps not supported by encoding/json, e.g.
+// floats or bools, are formatted as strings.
 func JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
-	buf := &bytes.Buffer{}
+	if err := encodeJSON(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+// RawJSON writes pre-encoded JSON to the response as is, setting the
+// Content-Type as application/json. Invalid JSON results in a 500 Internal
+// Server Error response.
+func RawJSON(w http.ResponseWriter, r *http.Request, data []byte) {
+	if err := encodeJSON(w, r, json.RawMessage(data)); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+// SafeJSONPrefix is the prefix written by SafeJSON before the JSON body,
+// which keeps it from being evaluated as a script, e.g. JSON hijacking. An
+// empty prefix disables it.
+var SafeJSONPrefix = ")]}',\n"
+
+// SafeJSON writes 'v' as JSON, like JSON, prefixed with SafeJSONPrefix for
+// clients stripping it before parsing the response.
+func SafeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	bw := newBufferWriter()
+	if err := encodeJSON(bw, r, v); err != nil {
+		encodeError(w, r, err)
+		return
+	}
+	bw.writeTo(w, append([]byte(SafeJSONPrefix), bw.body.Bytes()...))
+}
+
+func encodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return encodeJSONBuffer(w, r, v, &bytes.Buffer{})
+}
+
+// encodeJSONBuffer is like encodeJSON, using buf to encode v.
+func encodeJSONBuffer(w http.ResponseWriter, r *http.Request, v interface{}, buf *bytes.Buffer) error {
+	if err := canceled(r); err != nil {
+		return err
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		// Pre-encoded JSON is written as is, without re-encoding it.
+		encoding := contentEncoding(r)
+		if encoding == "" && !json.Valid(raw) {
+			return errors.New("render: invalid JSON in json.RawMessage")
+		}
+		if encoding != "" {
+			// Compressed already, so neither validated nor transcoded.
+			w.Header().Set("Content-Encoding", encoding)
+			w.Header().Set("Content-Type", contentType("application/json"))
+			applyHeaders(w, r)
+			writeHeader(w, r)
+			w.Write(raw) //nolint:errcheck
+			return nil
+		}
+		writeJSON(w, r, raw)
+		return nil
+	}
+
+	err := marshalJSON(buf, v, getFieldFilter(r))
+	if err == nil {
+		err = canceled(r) // the client may be gone by now
+	}
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, r, buf.Bytes())
+	return nil
+}
+
+// marshalJSON encodes v into buf as per the package settings, e.g. the naming
+// strategy, DeterministicJSON and OmitNullJSON, leaving out the fields
+// filtered out.
+func marshalJSON(buf *bytes.Buffer, v interface{}, filter *fieldFilter) error {
+	if jsonNamer != nil || filter != nil {
+		v = reflectJSON{v: v, namer: jsonNamer, filter: filter}
+	}
+
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(true)
-	if err := enc.Encode(v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	err := enc.Encode(v)
+	if isUnsupportedJSON(err) {
+		// Retry in case of maps with keys unsupported by encoding/json, e.g.
+		// map[float64]T, formatting their keys as strings.
+		buf.Reset()
+		err = enc.Encode(reflectJSON{v: v})
+	}
+	if err == nil && DeterministicJSON {
+		err = canonicalizeJSON(buf)
 	}
+	if err == nil && OmitNullJSON {
+		err = omitJSONNulls(buf)
+	}
+	return err
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
+// maxPooledBufferSize is the capacity above which buffers are left to the
+// garbage collector rather than pooled, so that a few large responses don't
+// pin memory.
+const maxPooledBufferSize = 64 << 10
+
+// NewPooledJSONEncoder returns an Encoder writing 'v' as JSON, exactly like
+// JSON, but reusing encoding buffers from a sync.Pool across responses, to
+// reduce allocations of high-throughput services. Use it with WithEncoder or
+// UseEncoder.
+func NewPooledJSONEncoder() Encoder {
+	pool := &sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+	return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		buf := pool.Get().(*bytes.Buffer)
+		defer func() {
+			if buf.Cap() <= maxPooledBufferSize {
+				buf.Reset()
+				pool.Put(buf)
+			}
+		}()
+		if err := encodeJSONBuffer(w, r, v, buf); err != nil {
+			encodeError(w, r, err)
+		}
 	}
-	w.Write(buf.Bytes()) //nolint:errcheck
+}
+
+// WriteJSON writes 'v' as JSON to w, exactly as JSON writes the response
+// body, e.g. for log files or message queues, without any HTTP header.
+func WriteJSON(w io.Writer, v interface{}) error {
+	buf := &bytes.Buffer{}
+	if err := marshalJSON(buf, v, nil); err != nil {
+		return err
+	}
+	_, err := w.Write(encodeCharset(buf.Bytes()))
+	return err
+}
+
+// RespectCancellation makes the responders give up, without writing
+// anything, once the request context is done, e.g. when the client is gone,
+// rather than encoding responses no one will read.
+var RespectCancellation = true
+
+// canceled returns the request context error, if RespectCancellation is set.
+func canceled(r *http.Request) error {
+	if !RespectCancellation {
+		return nil
+	}
+	return r.Context().Err()
+}
+
+// encodeError responds with a 500 Internal Server Error for encoding errors,
+// except for canceled requests, which get no response at all.
+func encodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if RespectCancellation && r.Context().Err() != nil && errors.Is(err, r.Context().Err()) {
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, b []byte) {
+	w.Header().Set("Content-Type", contentType("application/json"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset(b)) //nolint:errcheck
+}
+
+// OmitXMLDeclarationCtxKey is a context key to record that XML responses
+// should not be prefixed with an XML declaration.
+var OmitXMLDeclarationCtxKey = &contextKey{"OmitXMLDeclaration"}
+
+// OmitXMLDeclaration returns a shallow copy of r for which XML doesn't
+// prepend the generic XML header, e.g. for clients embedding the response as a
+// fragment.
+func OmitXMLDeclaration(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), OmitXMLDeclarationCtxKey, true))
 }
 
 // XML marshals 'v' to XML, setting the Content-Type as application/xml. It
 // will automatically prepend a generic XML header (see encoding/xml.Header) if
 // one is not found in the first 100 bytes of 'v'.
+// The header is left out for requests marked with OmitXMLDeclaration.
+// Namespaces set with WithXMLNamespaces are declared on the root element.
 func XML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := encodeXML(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+func encodeXML(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := canceled(r); err != nil {
+		return err
+	}
 	b, err := xml.Marshal(v)
+	if err == nil {
+		err = canceled(r)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	if XMLSelfClosingEmpty {
+		b = selfCloseEmptyXML(b)
+	}
+	if nsMap, ok := r.Context().Value(XMLNamespacesCtxKey).(map[string]string); ok {
+		b = declareXMLNamespaces(b, nsMap)
 	}
 
-	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
-	if status, ok := r.Context().Value(StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
+	w.Header().Set("Content-Type", contentType("application/xml"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+
+	omitHeader, _ := r.Context().Value(OmitXMLDeclarationCtxKey).(bool)
+	if !omitHeader {
+		b = prependXMLHeader(b)
 	}
 
+	w.Write(encodeCharset(b)) //nolint:errcheck
+	return nil
+}
+
+// prependXMLHeader prepends the XML declaration to b, unless present.
+func prependXMLHeader(b []byte) []byte {
 	// Try to find <?xml header in first 100 bytes (just in case there're some XML comments).
 	findHeaderUntil := len(b)
 	if findHeaderUntil > 100 {
 		findHeaderUntil = 100
 	}
-	if !bytes.Contains(b[:findHeaderUntil], []byte("<?xml")) {
-		// No header found. Print it out first.
-		w.Write([]byte(xml.Header)) //nolint:errcheck
+	if bytes.Contains(b[:findHeaderUntil], []byte("<?xml")) {
+		return b
+	}
+	// No header found. Print it out first.
+	return append([]byte(xmlHeader()), b...)
+}
+
+// WriteXML writes 'v' as XML to w, exactly as XML writes the response body,
+// without any HTTP header.
+func WriteXML(w io.Writer, v interface{}) error {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if XMLSelfClosingEmpty {
+		b = selfCloseEmptyXML(b)
 	}
+	_, err = w.Write(encodeCharset(prependXMLHeader(b)))
+	return err
+}
 
-	w.Write(b) //nolint:errcheck
+// xmlHeader returns the XML declaration matching Charset.
+func xmlHeader() string {
+	if Charset == "" || strings.EqualFold(Charset, "utf-8") {
+		return xml.Header
+	}
+	return `<?xml version="1.0" encoding="` + Charset + `"?>` + "\n"
+}
+
+// StreamXML writes an XML document with the given root element, encoding
+// each item received from the items channel as a child element as soon as it
+// arrives, so that large documents don't need to be held in memory. The root
+// element is closed once the channel is closed. Encoding errors, and client
+// disconnects, abort the stream and are reported to OnError.
+func StreamXML(w http.ResponseWriter, r *http.Request, root xml.StartElement, items <-chan interface{}) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write([]byte(xml.Header)) //nolint:errcheck
+
+	enc := xml.NewEncoder(w)
+	err := func() error {
+		if err := enc.EncodeToken(root); err != nil {
+			return err
+		}
+		ctx := r.Context()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case v, ok := <-items:
+				if !ok {
+					if err := enc.EncodeToken(root.End()); err != nil {
+						return err
+					}
+					return enc.Flush()
+				}
+				if err := enc.Encode(v); err != nil {
+					return err
+				}
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+			}
+		}
+	}()
+	if err != nil {
+		reportError(r, fmt.Errorf("render: xml stream: %w", err))
+	}
+}
+
+// NewCompressedXMLEncoder returns an Encoder writing 'v' as XML, like XML,
+// but gzip compressed at the given level, e.g. gzip.DefaultCompression, for
+// large documents such as feeds. It sets Content-Encoding as gzip regardless
+// of the request Accept-Encoding, so only use it with WithEncoder for clients
+// known to support it. Error responses are left uncompressed.
+func NewCompressedXMLEncoder(level int) Encoder {
+	return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		bw := newBufferWriter()
+		XML(bw, r, v)
+		if bw.Status() >= http.StatusBadRequest {
+			bw.writeTo(w, bw.body.Bytes())
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		zw, err := gzip.NewWriterLevel(buf, level)
+		if err != nil {
+			encodeError(w, r, err)
+			return
+		}
+		zw.Write(bw.body.Bytes()) //nolint:errcheck
+		if err := zw.Close(); err != nil {
+			reportError(r, fmt.Errorf("render: closing gzip writer: %w", err))
+			encodeError(w, r, err)
+			return
+		}
+
+		// The length of the uncompressed body, if set, no longer applies.
+		bw.header.Set("Content-Encoding", "gzip")
+		bw.header.Del("Content-Length")
+		w.Header().Del("Content-Length")
+		bw.writeTo(w, buf.Bytes())
+	}
+}
+
+// Form marshals 'v' to a URL-encoded form, setting the Content-Type as
+// application/x-www-form-urlencoded. Nested struct fields are encoded with
+// dot-notation keys, e.g. "address.city=Paris".
+func Form(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := encodeForm(w, r, v); err != nil {
+		encodeError(w, r, err)
+	}
+}
+
+func encodeForm(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := canceled(r); err != nil {
+		return err
+	}
+	s, err := form.EncodeToString(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write([]byte(s)) //nolint:errcheck
+	return nil
 }
 
 // NoContent returns a HTTP 204 "No Content" response.
 func NoContent(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNoContent)
+	NoContentStatus(w, r, http.StatusNoContent)
+}
+
+// NoContentStatus returns a response without body with the given status
+// code, e.g. 205 Reset Content or 304 Not Modified. Only status codes from 201
+// to 399 are accepted: 200 OK conventionally comes with a body, 1xx responses
+// are interim ones, and errors deserve one. Other status codes are reported
+// to OnError and nothing is written.
+func NoContentStatus(w http.ResponseWriter, r *http.Request, status int) {
+	if status <= http.StatusOK || status >= http.StatusBadRequest {
+		reportError(r, fmt.Errorf("render: invalid status code %d for a response without body", status))
+		return
+	}
+	applyHeaders(w, r)
+	w.WriteHeader(status)
+}
+
+// SSEPushPathCtxKey is a context key to record a resource to push over
+// HTTP/2 before an event stream starts.
+var SSEPushPathCtxKey = &contextKey{"SSEPushPath"}
+
+// SSEPushPath returns a shallow copy of r for which the event stream response
+// first pushes the resource at pushPath, e.g. the initial page, when served
+// over HTTP/2 by a server supporting http.Pusher.
+func SSEPushPath(r *http.Request, pushPath string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), SSEPushPathCtxKey, pushPath))
+}
+
+// SSEOptions configures event stream responses, see WithSSEOptions.
+type SSEOptions struct {
+	// HeartbeatInterval is the interval of ": ping" comments sent to keep
+	// the connection alive while idle. Zero disables them.
+	HeartbeatInterval time.Duration
+
+	// RetryMs is the reconnection time sent to the client, in milliseconds.
+	// Zero leaves it up to the client.
+	RetryMs int
+
+	// CloseOnContextDone ends the stream with an error event once the
+	// request context is done. Otherwise, the stream only ends once the
+	// channel is closed.
+	CloseOnContextDone bool
+}
+
+// DefaultSSEOptions are the options of event stream responses, unless set
+// with WithSSEOptions.
+var DefaultSSEOptions = SSEOptions{CloseOnContextDone: true}
+
+// SSEOptionsCtxKey is a context key to record the event stream options.
+var SSEOptionsCtxKey = &contextKey{"SSEOptions"}
+
+// WithSSEOptions returns a shallow copy of r with opts stored in its context,
+// for its event stream response. Start from DefaultSSEOptions, e.g.
+//
+//	opts := render.DefaultSSEOptions
+//	opts.HeartbeatInterval = 15 * time.Second
+//	r = render.WithSSEOptions(r, opts)
+func WithSSEOptions(r *http.Request, opts SSEOptions) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), SSEOptionsCtxKey, opts))
+}
+
+// newHeartbeatTicker returns the channel of a ticker sending event stream
+// heartbeats, and a func to stop it. It's replaced in tests.
+var newHeartbeatTicker = func(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
 }
 
 func channelEventStream(w http.ResponseWriter, r *http.Request, v interface{}) {
@@ -144,6 +1064,12 @@ func channelEventStream(w http.ResponseWriter, r *http.Request, v interface{}) {
 		panic(fmt.Sprintf("render: event stream expects a channel, not %v", reflect.TypeOf(v).Kind()))
 	}
 
+	if pushPath, ok := r.Context().Value(SSEPushPathCtxKey).(string); ok && r.ProtoMajor == 2 {
+		if p, ok := w.(http.Pusher); ok {
+			p.Push(pushPath, nil) //nolint:errcheck
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
 
@@ -153,18 +1079,43 @@ func channelEventStream(w http.ResponseWriter, r *http.Request, v interface{}) {
 		w.Header().Set("Connection", "keep-alive")
 	}
 
+	applyHeaders(w, r)
 	w.WriteHeader(http.StatusOK)
 
-	ctx := r.Context()
+	opts := DefaultSSEOptions
+	if o, ok := r.Context().Value(SSEOptionsCtxKey).(SSEOptions); ok {
+		opts = o
+	}
+	if opts.RetryMs > 0 {
+		w.Write([]byte(fmt.Sprintf("retry: %d\n\n", opts.RetryMs))) //nolint:errcheck
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv}, // a zero Chan is never selected
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(v)},
+		{Dir: reflect.SelectRecv},
+	}
+	if opts.CloseOnContextDone {
+		cases[0].Chan = reflect.ValueOf(r.Context().Done())
+	}
+	if opts.HeartbeatInterval > 0 {
+		tick, stop := newHeartbeatTicker(opts.HeartbeatInterval)
+		defer stop()
+		cases[2].Chan = reflect.ValueOf(tick)
+	}
+
 	for {
-		switch chosen, recv, ok := reflect.Select([]reflect.SelectCase{
-			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
-			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(v)},
-		}); chosen {
+		switch chosen, recv, ok := reflect.Select(cases); chosen {
 		case 0: // equivalent to: case <-ctx.Done()
 			w.Write([]byte("event: error\ndata: {\"error\":\"Server Timeout\"}\n\n")) //nolint:errcheck
 			return
 
+		case 2: // equivalent to: case <-ticker.C
+			w.Write([]byte(": ping\n\n")) //nolint:errcheck
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+
 		default: // equivalent to: case v, ok := <-stream
 			if !ok {
 				w.Write([]byte("event: EOF\n\n")) //nolint:errcheck
@@ -182,7 +1133,8 @@ func channelEventStream(w http.ResponseWriter, r *http.Request, v interface{}) {
 				}
 			}
 
-			bytes, err := json.Marshal(v)
+			buf := &bytes.Buffer{}
+			err := marshalJSON(buf, v, getFieldFilter(r))
 			if err != nil {
 				w.Write([]byte(fmt.Sprintf("event: error\ndata: {\"error\":\"%v\"}\n\n", err))) //nolint:errcheck
 				if f, ok := w.(http.Flusher); ok {
@@ -190,7 +1142,7 @@ func channelEventStream(w http.ResponseWriter, r *http.Request, v interface{}) {
 				}
 				continue
 			}
-			w.Write([]byte(fmt.Sprintf("event: data\ndata: %s\n\n", bytes))) //nolint:errcheck
+			w.Write([]byte(fmt.Sprintf("event: data\ndata: %s\n\n", bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))) //nolint:errcheck
 			if f, ok := w.(http.Flusher); ok {
 				f.Flush()
 			}
@@ -232,3 +1184,59 @@ func channelIntoSlice(w http.ResponseWriter, r *http.Request, from interface{})
 		}
 	}
 }
+
+// Responder is an instance of the package-level responding and decoding
+// helpers with its own configuration, so that handlers can have it injected
+// rather than relying on the global Respond and Decode variables.
+type Responder struct {
+	// Encoder, if set, encodes all responses, regardless of the request
+	// Accept header.
+	Encoder Encoder
+
+	// Decoder, if set, decodes all request bodies, regardless of the request
+	// Content-Type.
+	Decoder Decoder
+}
+
+// New returns a Responder with the package defaults.
+func New() *Responder {
+	return &Responder{}
+}
+
+// Respond encodes v with the Responder Encoder, if set, or as per
+// DefaultResponder otherwise.
+func (rs *Responder) Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if rs.Encoder != nil {
+		r = WithEncoder(r, rs.Encoder)
+	}
+	DefaultResponder(w, r, v)
+}
+
+// Decode decodes the request body into v with the Responder Decoder, if set,
+// or as per DefaultDecoder otherwise.
+func (rs *Responder) Decode(r *http.Request, v interface{}) error {
+	if rs.Decoder != nil {
+		r = WithDecoder(r, rs.Decoder)
+	}
+	return DefaultDecoder(r, v)
+}
+
+// JSON writes v as JSON, see the package-level JSON.
+func (rs *Responder) JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	JSON(w, r, v)
+}
+
+// XML writes v as XML, see the package-level XML.
+func (rs *Responder) XML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	XML(w, r, v)
+}
+
+// PlainText writes v as plain text, see the package-level PlainText.
+func (rs *Responder) PlainText(w http.ResponseWriter, r *http.Request, v string) {
+	PlainText(w, r, v)
+}
+
+// Status sets a HTTP response status code hint, see the package-level Status.
+func (rs *Responder) Status(r *http.Request, status int) {
+	Status(r, status)
+}
@@ -0,0 +1,1205 @@
+package render
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ctxKeyTest struct{}
+
+// countSuccess sets OnSuccess to count its calls, until the returned func
+// restores it.
+func countSuccess(calls *int) func() {
+	prev := OnSuccess
+	OnSuccess = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		*calls++
+	}
+	return func() { OnSuccess = prev }
+}
+
+func TestOnSuccess(t *testing.T) {
+	defer func(prev func(http.ResponseWriter, *http.Request, interface{})) { OnSuccess = prev }(OnSuccess)
+
+	var (
+		calls int
+		got   interface{}
+		user  string
+	)
+	OnSuccess = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		calls++
+		got = v
+		user, _ = r.Context().Value(ctxKeyTest{}).(string)
+	}
+
+	v := M{"a": 1}
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ctxKeyTest{}, "gopher"))
+	Respond(httptest.NewRecorder(), r, v)
+
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	if m, ok := got.(M); !ok || m["a"] != 1 {
+		t.Errorf("got value %v, want the original value", got)
+	}
+	if user != "gopher" {
+		t.Errorf("got context value %q, want gopher", user)
+	}
+}
+
+func TestOnSuccessNotCalledOnFailure(t *testing.T) {
+	var calls int
+	defer countSuccess(&calls)()
+
+	failing := func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"encode error", func(w http.ResponseWriter, r *http.Request) {
+			Respond(w, r, M{"nan": math.NaN()})
+		}},
+		{"error value", func(w http.ResponseWriter, r *http.Request) {
+			Respond(w, r, errors.New("db down"))
+		}},
+		{"RenderError", func(w http.ResponseWriter, r *http.Request) {
+			RenderError(w, r, errors.New("db down"))
+		}},
+		{"failing encoder", func(w http.ResponseWriter, r *http.Request) {
+			Respond(w, WithEncoder(r, failing), M{"a": 1})
+		}},
+		{"error status", func(w http.ResponseWriter, r *http.Request) {
+			RespondStatus(w, WithEncoder(r, JSON), http.StatusNotFound, M{"a": 1})
+		}},
+	}
+	for _, tt := range tests {
+		calls = 0
+		w := httptest.NewRecorder()
+		tt.respond(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code < http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want an error status", tt.name, w.Code)
+		}
+		if calls != 0 {
+			t.Errorf("%s: OnSuccess called %d times", tt.name, calls)
+		}
+	}
+}
+
+func TestOnSuccessWithEncoder(t *testing.T) {
+	var calls int
+	defer countSuccess(&calls)()
+
+	w := httptest.NewRecorder()
+	Respond(w, WithEncoder(httptest.NewRequest("GET", "/", nil), XML), namedPayload{"gopher"})
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
+
+// gzipEncoder is a CloseableEncoder streaming JSON through a gzip writer.
+type gzipEncoder struct {
+	zw        *gzip.Writer
+	encodeErr error
+	closeErr  error
+	closes    int
+}
+
+func (e *gzipEncoder) Encode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if e.encodeErr != nil {
+		return e.encodeErr
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	e.zw = gzip.NewWriter(w)
+	return json.NewEncoder(e.zw).Encode(v)
+}
+
+func (e *gzipEncoder) Close() error {
+	e.closes++
+	if e.zw != nil {
+		e.zw.Close()
+	}
+	return e.closeErr
+}
+
+func TestCloseableEncoder(t *testing.T) {
+	errEncode := errors.New("encode failed")
+	errClose := errors.New("close failed")
+	tests := []struct {
+		name        string
+		enc         *gzipEncoder
+		wantStatus  int
+		wantErrs    int
+		wantSuccess int
+	}{
+		{"ok", &gzipEncoder{}, http.StatusOK, 0, 1},
+		{"encode error", &gzipEncoder{encodeErr: errEncode}, http.StatusInternalServerError, 0, 0},
+		{"close error", &gzipEncoder{closeErr: errClose}, http.StatusOK, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				errs  []error
+				calls int
+			)
+			defer captureErrors(&errs)()
+			defer countSuccess(&calls)()
+
+			w := httptest.NewRecorder()
+			r := WithCloseableEncoder(httptest.NewRequest("GET", "/", nil), tt.enc)
+			Respond(w, r, M{"name": "gopher"})
+
+			if tt.enc.closes != 1 {
+				t.Errorf("Close called %d times, want 1", tt.enc.closes)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if len(errs) != tt.wantErrs || tt.wantErrs > 0 && !errors.Is(errs[0], errClose) {
+				t.Errorf("got errors %v, want %d", errs, tt.wantErrs)
+			}
+			if calls != tt.wantSuccess {
+				t.Errorf("OnSuccess called %d times, want %d", calls, tt.wantSuccess)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ := io.ReadAll(zr)
+				if got := string(b); got != "{\"name\":\"gopher\"}\n" {
+					t.Errorf("got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedXMLEncoder(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Length", "40")
+	r := WithEncoder(httptest.NewRequest("GET", "/", nil), NewCompressedXMLEncoder(gzip.BestSpeed))
+	Respond(w, r, namedPayload{Name: "gopher"})
+
+	if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("got Content-Encoding %q, want gzip", ce)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("got Content-Length %q, want none", cl)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p namedPayload
+	if err := xml.NewDecoder(zr).Decode(&p); err != nil || p.Name != "gopher" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	w = httptest.NewRecorder()
+	r = WithEncoder(httptest.NewRequest("GET", "/", nil), NewCompressedXMLEncoder(42))
+	Respond(w, r, namedPayload{Name: "gopher"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("invalid level: got status %d, want 500", w.Code)
+	}
+}
+
+func TestNoContentStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		respond    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantErrs   int
+	}{
+		{"no content", NoContent, http.StatusNoContent, 0},
+		{"reset content", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, http.StatusResetContent) }, http.StatusResetContent, 0},
+		{"not modified", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, http.StatusNotModified) }, http.StatusNotModified, 0},
+		{"ok", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, http.StatusOK) }, 0, 1},
+		{"continue", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, http.StatusContinue) }, 0, 1},
+		{"not found", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, http.StatusNotFound) }, 0, 1},
+		{"out of range", func(w http.ResponseWriter, r *http.Request) { NoContentStatus(w, r, 42) }, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			defer captureErrors(&errs)()
+
+			w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+			tt.respond(w, httptest.NewRequest("GET", "/", nil))
+			var want []int
+			if tt.wantStatus != 0 {
+				want = []int{tt.wantStatus}
+			}
+			if fmt.Sprint(w.codes) != fmt.Sprint(want) {
+				t.Errorf("got status codes %v, want %v", w.codes, want)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("got body %q, want none", w.Body.String())
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("got errors %v, want %d", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestStreamXML(t *testing.T) {
+	items := make(chan interface{})
+	go func() {
+		defer close(items)
+		for i := 0; i < 5; i++ {
+			items <- namedPayload{Name: fmt.Sprintf("gopher %d", i)}
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	Status(r, http.StatusPartialContent)
+	StreamXML(w, r, xml.StartElement{Name: xml.Name{Local: "feed"}}, items)
+
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusPartialContent)
+	}
+	var feed struct {
+		XMLName xml.Name       `xml:"feed"`
+		Items   []namedPayload `xml:"namedPayload"`
+	}
+	if err := xml.NewDecoder(w.Body).Decode(&feed); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if len(feed.Items) != 5 {
+		t.Fatalf("got %d items, want 5", len(feed.Items))
+	}
+	for i, item := range feed.Items {
+		if want := fmt.Sprintf("gopher %d", i); item.Name != want {
+			t.Errorf("item %d: got %q, want %q", i, item.Name, want)
+		}
+	}
+}
+
+func TestStreamXMLCanceled(t *testing.T) {
+	var errs []error
+	defer captureErrors(&errs)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	StreamXML(httptest.NewRecorder(), r, xml.StartElement{Name: xml.Name{Local: "feed"}}, make(chan interface{}))
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("got errors %v, want context.Canceled", errs)
+	}
+}
+
+func TestForm(t *testing.T) {
+	type address struct {
+		City string `form:"city"`
+	}
+	v := struct {
+		Name    string  `form:"name"`
+		Age     int     `form:"age"`
+		Address address `form:"address"`
+	}{"gopher & co", 13, address{"Paris"}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	Status(r, http.StatusAccepted)
+	Form(w, r, v)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want 202", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	values, err := url.ParseQuery(w.Body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"name": {"gopher & co"}, "age": {"13"}, "address.city": {"Paris"}}
+	if fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+}
+
+func TestFormNegotiated(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/x-www-form-urlencoded")
+	Respond(w, r, namedPayload{Name: "gopher"})
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-www-form-urlencoded" || w.Body.String() != "name=gopher" {
+		t.Errorf("got %q %q", ct, w.Body.String())
+	}
+}
+
+func TestUseEncoder(t *testing.T) {
+	custom := func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		PlainText(w, r, "custom")
+	}
+	h := UseEncoder(custom)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Respond(w, r, M{"name": "gopher"})
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "custom" {
+		t.Errorf("got %q, want the custom encoder", w.Body.String())
+	}
+
+	// The request outside of the middleware is left alone.
+	w = httptest.NewRecorder()
+	Respond(w, r, M{"name": "gopher"})
+	if w.Body.String() != "{\"name\":\"gopher\"}\n" {
+		t.Errorf("got %q, want JSON", w.Body.String())
+	}
+}
+
+// declaredXML marshals itself with its own XML declaration.
+type declaredXML struct{}
+
+func (declaredXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)}); err != nil {
+		return err
+	}
+	start.Name.Local = "declared"
+	return e.EncodeElement("", start)
+}
+
+func TestXMLDeclaration(t *testing.T) {
+	tests := []struct {
+		name string
+		r    func(r *http.Request) *http.Request
+		v    interface{}
+		want string
+	}{
+		{"default", func(r *http.Request) *http.Request { return r }, namedPayload{"gopher"}, xml.Header + "<namedPayload><name>gopher</name></namedPayload>"},
+		{"omitted", OmitXMLDeclaration, namedPayload{"gopher"}, "<namedPayload><name>gopher</name></namedPayload>"},
+		{"declared", func(r *http.Request) *http.Request { return r }, declaredXML{}, `<?xml version="1.0"?><declared></declared>`},
+		{"declared omitted", OmitXMLDeclaration, declaredXML{}, `<?xml version="1.0"?><declared></declared>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			XML(w, tt.r(httptest.NewRequest("GET", "/", nil)), tt.v)
+			if w.Body.String() != tt.want {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResponderInstances(t *testing.T) {
+	xmlResponder := &Responder{Encoder: XML}
+	jsonResponder := &Responder{Encoder: JSON, Decoder: DecodeJSONStrict}
+	defaults := New()
+
+	tests := []struct {
+		name     string
+		rs       *Responder
+		wantType string
+	}{
+		{"xml", xmlResponder, "application/xml; charset=utf-8"},
+		{"json", jsonResponder, "application/json; charset=utf-8"},
+		{"defaults", defaults, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			tt.rs.Status(r, http.StatusAccepted)
+			tt.rs.Respond(w, r, namedPayload{Name: "gopher"})
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", ct, tt.wantType)
+			}
+			if w.Code != http.StatusAccepted {
+				t.Errorf("got status %d, want 202", w.Code)
+			}
+		})
+	}
+
+	body := `{"name":"gopher","extra":1}`
+	var p namedPayload
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if err := jsonResponder.Decode(r, &p); err == nil {
+		t.Error("strict decoder accepted an unknown field")
+	}
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if err := defaults.Decode(r, &p); err != nil || p.Name != "gopher" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+}
+
+func TestTransformResponse(t *testing.T) {
+	defer func(prev func(interface{}) interface{}) { TransformResponse = prev }(TransformResponse)
+	envelope := func(v interface{}) interface{} { return M{"data": v} }
+
+	tests := []struct {
+		name      string
+		transform func(interface{}) interface{}
+		v         interface{}
+		want      string
+	}{
+		{"nil transform", nil, M{"name": "gopher"}, `{"name":"gopher"}`},
+		{"envelope", envelope, M{"name": "gopher"}, `{"data":{"name":"gopher"}}`},
+		{"nil value", envelope, nil, `{"data":null}`},
+		{"channel", envelope, func() interface{} {
+			ch := make(chan int, 2)
+			ch <- 1
+			ch <- 2
+			close(ch)
+			return ch
+		}(), `{"data":[1,2]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TransformResponse = tt.transform
+			w := httptest.NewRecorder()
+			Respond(w, httptest.NewRequest("GET", "/", nil), tt.v)
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type unsortedMarshaler struct{}
+
+func (unsortedMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{"b": 1.0, "a": {"d": [{"f": 1, "e": 2}], "c": null}}`), nil
+}
+
+func TestDeterministicJSON(t *testing.T) {
+	defer func(enabled bool) { DeterministicJSON = enabled }(DeterministicJSON)
+
+	values := []interface{}{
+		unsortedMarshaler{},
+		M{"b": json.Number("1.0"), "a": json.RawMessage(`{"d": [{"f": 1, "e": 2}], "c": null}`)},
+		struct {
+			B json.Number            `json:"b"`
+			A map[string]interface{} `json:"a"`
+		}{"1.0", M{"d": []M{{"f": 1, "e": 2}}, "c": nil}},
+	}
+	want := `{"a":{"c":null,"d":[{"e":2,"f":1}]},"b":1.0}` + "\n"
+
+	respond := func(v interface{}) string {
+		w := httptest.NewRecorder()
+		JSON(w, httptest.NewRequest("GET", "/", nil), v)
+		return w.Body.String()
+	}
+
+	DeterministicJSON = true
+	for i, v := range values {
+		if got := respond(v); got != want {
+			t.Errorf("value %d: got %s, want %s", i, got, want)
+		}
+	}
+
+	DeterministicJSON = false
+	if got := respond(values[2]); got != `{"b":1.0,"a":{"c":null,"d":[{"e":2,"f":1}]}}`+"\n" {
+		t.Errorf("disabled: got %s, want the struct field order", got)
+	}
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (w *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestSSEPushPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		proto int
+		path  bool
+		want  int
+	}{
+		{"http2", 2, true, 1},
+		{"http1", 1, true, 0},
+		{"not configured", 2, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/events", nil)
+			r.ProtoMajor = tt.proto
+			r.Header.Set("Accept", "text/event-stream")
+			if tt.path {
+				r = SSEPushPath(r, "/app.js")
+			}
+			ch := make(chan M, 2)
+			ch <- M{"n": 1}
+			ch <- M{"n": 2}
+			close(ch)
+
+			w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			Respond(w, r, ch)
+			if len(w.pushed) != tt.want {
+				t.Fatalf("got pushes %v, want %d", w.pushed, tt.want)
+			}
+			if tt.want > 0 && w.pushed[0] != "/app.js" {
+				t.Errorf("got push %q, want /app.js", w.pushed[0])
+			}
+			if got := strings.Count(w.Body.String(), "event: data"); got != 2 {
+				t.Errorf("got %d events, want 2: %s", got, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRespondStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request, status int, v interface{})
+		v       interface{}
+		ct      string
+		want    string
+	}{
+		{"respond", RespondStatus, M{"id": 1}, "application/json", `{"id":1}`},
+		{"json", JSONStatus, M{"id": 1}, "application/json", `{"id":1}`},
+		{"xml", XMLStatus, &namedPayload{Name: "a"}, "application/xml", `<namedPayload><name>a</name></namedPayload>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			tt.respond(w, r, http.StatusCreated, tt.v)
+			if w.Code != http.StatusCreated {
+				t.Errorf("got status %d, want 201", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.ct) {
+				t.Errorf("got Content-Type %q, want %s", got, tt.ct)
+			}
+			if got := w.Body.String(); !strings.Contains(got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSEOptions(t *testing.T) {
+	tick := make(chan time.Time)
+	stopped := false
+	prev := newHeartbeatTicker
+	newHeartbeatTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		if d != 15*time.Second {
+			t.Errorf("got heartbeat interval %v, want 15s", d)
+		}
+		return tick, func() { stopped = true }
+	}
+	defer func() { newHeartbeatTicker = prev }()
+
+	opts := DefaultSSEOptions
+	opts.HeartbeatInterval = 15 * time.Second
+	opts.RetryMs = 3000
+	r := WithSSEOptions(acceptRequest("text/event-stream"), opts)
+
+	ch := make(chan M)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Respond(w, r, ch)
+	}()
+	tick <- time.Now() // received once the stream waits for events
+	ch <- M{"n": 1}
+	close(ch)
+	<-done
+
+	want := "retry: 3000\n\n: ping\n\nevent: data\ndata: {\"n\":1}\n\nevent: EOF\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !stopped {
+		t.Error("heartbeat ticker not stopped")
+	}
+}
+
+func TestSSEOptionsCloseOnContextDone(t *testing.T) {
+	tests := []struct {
+		name  string
+		close bool
+		want  string
+	}{
+		{"close", true, "event: error\ndata: {\"error\":\"Server Timeout\"}\n\n"},
+		{"keep open", false, "event: data\ndata: {\"n\":1}\n\nevent: EOF\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			r := acceptRequest("text/event-stream").WithContext(ctx)
+			r = WithSSEOptions(r, SSEOptions{CloseOnContextDone: tt.close})
+
+			ch := make(chan M, 1)
+			if !tt.close {
+				ch <- M{"n": 1}
+				close(ch)
+			}
+			w := httptest.NewRecorder()
+			Respond(w, r, ch)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"raw message", func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, json.RawMessage(`{ "b": 1, "a": "<x>" }`))
+		}},
+		{"raw json", func(w http.ResponseWriter, r *http.Request) {
+			RawJSON(w, r, []byte(`{ "b": 1, "a": "<x>" }`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.respond(w, httptest.NewRequest("GET", "/", nil))
+			if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+				t.Errorf("got Content-Type %q", got)
+			}
+			if got, want := w.Body.String(), `{ "b": 1, "a": "<x>" }`; got != want {
+				t.Errorf("got %s, want %s as is", got, want)
+			}
+		})
+	}
+}
+
+func TestRawJSONInvalid(t *testing.T) {
+	w := httptest.NewRecorder()
+	RawJSON(w, httptest.NewRequest("GET", "/", nil), []byte(`{"a":`))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), `{"a":`) {
+		t.Errorf("got invalid JSON written: %s", w.Body.String())
+	}
+}
+
+func TestRenderToBytes(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		v      interface{}
+	}{
+		{"json", "application/json", M{"name": "gopher"}},
+		{"xml", "application/xml", &namedPayload{Name: "gopher"}},
+		{"plain text", "text/plain", "gopher"},
+		{"renderer", "application/json", &statusPayload{Name: "gopher", status: http.StatusCreated}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ct, err := RenderToBytes(acceptRequest(tt.accept), tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := acceptRequest(tt.accept)
+			if rv, ok := tt.v.(Renderer); ok {
+				if err := Render(w, r, rv); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				Respond(w, r, tt.v)
+			}
+			if string(body) != w.Body.String() {
+				t.Errorf("got body %q, want %q", body, w.Body.String())
+			}
+			if want := w.Header().Get("Content-Type"); ct != want {
+				t.Errorf("got Content-Type %q, want %q", ct, want)
+			}
+		})
+	}
+}
+
+func TestRenderToBytesError(t *testing.T) {
+	r := acceptRequest("application/json")
+	body, ct, err := RenderToBytes(r, NewErrResponse(http.StatusNotFound, nil))
+	if err == nil {
+		t.Error("got no error for a 404 response")
+	}
+	if ct != "application/problem+json; charset=utf-8" || !strings.Contains(string(body), `"status":404`) {
+		t.Errorf("got %s, %q", body, ct)
+	}
+
+	errRender := errors.New("render failed")
+	if _, _, err := RenderToBytes(r, &renderedPayload{err: errRender}); err != errRender {
+		t.Errorf("got error %v, want %v", err, errRender)
+	}
+	if _, ok := r.Context().Value(StatusCtxKey).(int); ok {
+		t.Error("request status hint modified")
+	}
+}
+
+func TestSafeJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	SafeJSON(w, httptest.NewRequest("GET", "/", nil), []int{1, 2})
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, ")]}',\n") {
+		t.Fatalf("got %q, want the prefix", body)
+	}
+	var v []int
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(body, ")]}',\n")), &v); err != nil || len(v) != 2 {
+		t.Errorf("got %v, %v after the prefix", v, err)
+	}
+}
+
+func TestSafeJSONNoPrefix(t *testing.T) {
+	defer func(prev string) { SafeJSONPrefix = prev }(SafeJSONPrefix)
+	SafeJSONPrefix = ""
+
+	w := httptest.NewRecorder()
+	SafeJSON(w, httptest.NewRequest("GET", "/", nil), []int{1, 2})
+	if got := strings.TrimSpace(w.Body.String()); got != "[1,2]" {
+		t.Errorf("got %q, want plain JSON", got)
+	}
+}
+
+func TestRespectCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request, v interface{})
+	}{
+		{"json", JSON},
+		{"xml", XML},
+		{"form", Form},
+		{"respond", Respond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+			tt.respond(w, r, &namedPayload{Name: "gopher"})
+			if len(w.codes) != 0 || w.Body.Len() != 0 {
+				t.Errorf("got status codes %v and body %q, want no writes", w.codes, w.Body.String())
+			}
+		})
+	}
+
+	if err := encodeJSON(httptest.NewRecorder(), r, M{}); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestRespectCancellationDisabled(t *testing.T) {
+	defer func(prev bool) { RespectCancellation = prev }(RespectCancellation)
+	RespectCancellation = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	JSON(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx), M{"a": 1})
+	if got := strings.TrimSpace(w.Body.String()); got != `{"a":1}` {
+		t.Errorf("got %q, want the response written", got)
+	}
+}
+
+func TestSetContentEncoding(t *testing.T) {
+	gz := compressed(t, "gzip", []byte(`{"name":"gopher"}`)).Bytes()
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request)
+		ct      string
+	}{
+		{"data", func(w http.ResponseWriter, r *http.Request) { Data(w, r, gz) }, "application/octet-stream"},
+		{"raw json", func(w http.ResponseWriter, r *http.Request) { RawJSON(w, r, gz) }, "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.respond(w, SetContentEncoding(httptest.NewRequest("GET", "/", nil), "gzip"))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+				t.Errorf("got Content-Encoding %q, want gzip", got)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.ct {
+				t.Errorf("got Content-Type %q, want %q", got, tt.ct)
+			}
+			if !bytes.Equal(w.Body.Bytes(), gz) {
+				t.Error("got the body modified, want it as is")
+			}
+		})
+	}
+}
+
+func TestSetContentEncodingUnset(t *testing.T) {
+	w := httptest.NewRecorder()
+	Data(w, httptest.NewRequest("GET", "/", nil), []byte("data"))
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("got Content-Encoding %q, want none", got)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+	defer func(prev bool) { OmitNullJSON = prev }(OmitNullJSON)
+
+	v := struct {
+		FirstName string
+		Bio       *string
+		HTML      string
+	}{FirstName: "gopher", HTML: "<b>"}
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{"default", func() {}},
+		{"naming strategy", func() { SetJSONNamingStrategy(SnakeCaseNamer) }},
+		{"omit nulls", func() { OmitNullJSON = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			buf := &bytes.Buffer{}
+			if err := WriteJSON(buf, v); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			JSON(w, httptest.NewRequest("GET", "/", nil), v)
+			if buf.String() != w.Body.String() {
+				t.Errorf("got %q, want %q", buf.String(), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	defer func(prev bool) { XMLSelfClosingEmpty = prev }(XMLSelfClosingEmpty)
+
+	for _, selfClosing := range []bool{false, true} {
+		XMLSelfClosingEmpty = selfClosing
+		v := &namedPayload{}
+		buf := &bytes.Buffer{}
+		if err := WriteXML(buf, v); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		XML(w, httptest.NewRequest("GET", "/", nil), v)
+		if buf.String() != w.Body.String() {
+			t.Errorf("self closing %v: got %q, want %q", selfClosing, buf.String(), w.Body.String())
+		}
+	}
+
+	if err := WriteXML(&bytes.Buffer{}, make(chan int)); err == nil {
+		t.Error("got no error for an unsupported value")
+	}
+}
+
+func TestOmitNullJSON(t *testing.T) {
+	defer func(prev bool) { OmitNullJSON = prev }(OmitNullJSON)
+	OmitNullJSON = true
+
+	type inner struct {
+		A *int
+		B []int
+	}
+	one := 1
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil pointers", struct{ A, B *int }{}, `{}`},
+		{"some nil", struct {
+			A, B *int
+			C    string
+		}{A: &one, C: "<c>"}, `{"A":1,"C":"\u003cc\u003e"}`},
+		{"map", map[string]interface{}{"a": nil, "b": 1.5, "c": nil}, `{"b":1.5}`},
+		{"array elements kept", []interface{}{nil, 1, nil}, `[null,1,null]`},
+		{"nested", M{"x": []interface{}{M{"a": nil}, inner{}}, "y": inner{A: &one}}, `{"x":[{},{}],"y":{"A":1}}`},
+		{"escaped keys", map[string]interface{}{`"q"`: 1, "n": nil}, `{"\"q\"":1}`},
+		{"numbers", M{"big": json.Number("12345678901234567890")}, `{"big":12345678901234567890}`},
+		{"top-level null", nil, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			JSON(w, httptest.NewRequest("GET", "/", nil), tt.v)
+			if got := w.Body.String(); got != tt.want+"\n" {
+				t.Errorf("got %q, want %q", got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func TestRespondMultipleAcceptedTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"json fallback", "text/html, application/json;q=0.9", "application/json"},
+		{"xml fallback", "text/html, application/xml;q=0.9, application/json;q=0.5", "application/xml"},
+		{"quality order", "application/json;q=0.5, application/xml", "application/xml"},
+		{"no supported type", "text/html, image/png", "application/json"},
+		{"form", "text/html, application/x-www-form-urlencoded;q=0.1", "application/x-www-form-urlencoded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, acceptRequest(tt.accept), &namedPayload{Name: "gopher"})
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("got Content-Type %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// chromeAccept is the Accept header of Chrome navigations.
+const chromeAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+
+func TestRespondBrowserAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		v      interface{}
+		want   string
+		status int
+	}{
+		{"struct", chromeAccept, &namedPayload{Name: "gopher"}, "application/json", http.StatusOK},
+		{"map", chromeAccept, M{"name": "gopher"}, "application/json", http.StatusOK},
+		{"firefox", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", M{"name": "gopher"}, "application/json", http.StatusOK},
+		{"application wildcard", "application/xml, application/*;q=0.1", &namedPayload{Name: "gopher"}, "application/json", http.StatusOK},
+		{"json excluded", "application/json;q=0, */*", &namedPayload{Name: "gopher"}, "application/xml", http.StatusOK},
+		{"explicit json", "application/xml, application/json;q=0.5", &namedPayload{Name: "gopher"}, "application/xml", http.StatusOK},
+		{"json fallback", "application/xml, application/json;q=0.5", M{"name": "gopher"}, "application/json", http.StatusOK},
+		{"no fallback", "application/xml", M{"name": "gopher"}, "text/plain", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, acceptRequest(tt.accept), tt.v)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("got Content-Type %q, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRespondErrorBrowserAccept(t *testing.T) {
+	w := httptest.NewRecorder()
+	Respond(w, acceptRequest(chromeAccept), notFoundError{})
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/problem+json") {
+		t.Errorf("got Content-Type %q, want problem JSON", got)
+	}
+}
+
+func TestRespondErrorMultipleAcceptedTypes(t *testing.T) {
+	w := httptest.NewRecorder()
+	Respond(w, acceptRequest("text/html, application/xml;q=0.9"), notFoundError{})
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/problem+xml") {
+		t.Errorf("got Content-Type %q, want problem XML", got)
+	}
+}
+
+func TestPooledJSONEncoder(t *testing.T) {
+	enc := NewPooledJSONEncoder()
+	values := []interface{}{
+		M{"name": "<gopher>", "tags": []string{"a", "b"}},
+		&namedPayload{Name: "gopher"},
+		strings.Repeat("x", maxPooledBufferSize+1), // not pooled
+		[]int{1, 2, 3},
+		nil,
+	}
+	for i, v := range values {
+		r := httptest.NewRequest("GET", "/", nil)
+		want := httptest.NewRecorder()
+		JSON(want, r, v)
+		got := httptest.NewRecorder()
+		Respond(got, WithEncoder(r, enc), v)
+		if got.Body.String() != want.Body.String() {
+			t.Errorf("value %d: got %q, want %q", i, got.Body.String(), want.Body.String())
+		}
+		if got.Header().Get("Content-Type") != want.Header().Get("Content-Type") {
+			t.Errorf("value %d: got Content-Type %q", i, got.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// discardWriter is a http.ResponseWriter discarding the response.
+type discardWriter struct{ header http.Header }
+
+func (w discardWriter) Header() http.Header         { return w.header }
+func (w discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardWriter) WriteHeader(int)             {}
+
+func benchmarkJSONEncoder(b *testing.B, enc Encoder) {
+	v := M{"name": "gopher", "tags": []string{"a", "b", "c"}, "n": 42}
+	r := httptest.NewRequest("GET", "/", nil)
+	w := discardWriter{http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc(w, r, v)
+	}
+}
+
+func BenchmarkJSON(b *testing.B)              { benchmarkJSONEncoder(b, JSON) }
+func BenchmarkPooledJSONEncoder(b *testing.B) { benchmarkJSONEncoder(b, NewPooledJSONEncoder()) }
+
+func TestMultiEncoder(t *testing.T) {
+	var calls []string
+	tracked := func(name string, enc Encoder) Encoder {
+		return func(w http.ResponseWriter, r *http.Request, v interface{}) {
+			calls = append(calls, name)
+			enc(w, r, v)
+		}
+	}
+	partial := func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		w.Header().Set("X-Partial", "1")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"a":`)) //nolint:errcheck
+	}
+	data := func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		b, ok := v.([]byte)
+		if !ok {
+			http.Error(w, "not bytes", http.StatusInternalServerError)
+			return
+		}
+		Data(w, r, b)
+	}
+
+	tests := []struct {
+		name       string
+		encoders   []Encoder
+		v          interface{}
+		wantCalls  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"first succeeds", []Encoder{tracked("data", data), tracked("json", JSON)}, []byte("raw"), "data", http.StatusOK, "raw"},
+		{"second succeeds", []Encoder{tracked("data", data), tracked("json", JSON)}, M{"a": 1}, "data,json", http.StatusOK, "{\"a\":1}\n"},
+		{"no partial write", []Encoder{tracked("partial", partial), tracked("json", JSON)}, M{"a": 1}, "partial,json", http.StatusOK, "{\"a\":1}\n"},
+		{"all fail", []Encoder{tracked("data", data), tracked("partial", partial)}, M{"a": 1}, "data,partial", http.StatusInternalServerError, ""},
+		{"none", nil, M{"a": 1}, "", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			w := httptest.NewRecorder()
+			MultiEncoder(tt.encoders...)(w, httptest.NewRequest("GET", "/", nil), tt.v)
+			if got := strings.Join(calls, ","); got != tt.wantCalls {
+				t.Errorf("got attempts %s, want %s", got, tt.wantCalls)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && w.Header().Get("X-Partial") != "" {
+				t.Error("got the header of a failed attempt")
+			}
+		})
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	tests := []struct {
+		name     string
+		respond  func(w http.ResponseWriter, r *http.Request)
+		wantType string
+		wantBody string
+	}{
+		{"string", func(w http.ResponseWriter, r *http.Request) { WriteString(w, r, "OK") }, "text/plain; charset=utf-8", "OK"},
+		{"stringf", func(w http.ResponseWriter, r *http.Request) { WriteStringf(w, r, "v%d.%d", 1, 2) }, "text/plain; charset=utf-8", "v1.2"},
+		{"bytes", func(w http.ResponseWriter, r *http.Request) { WriteBytes(w, r, []byte{1, 2}) }, "application/octet-stream", "\x01\x02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			Status(r, http.StatusAccepted)
+			w := httptest.NewRecorder()
+			tt.respond(w, r)
+			if w.Code != http.StatusAccepted {
+				t.Errorf("got status %d, want 202", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.wantType)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		ct   ContentType
+		v    interface{}
+		want string
+	}{
+		{"json", ContentTypeJSON, M{"name": "gopher"}, "{\"name\":\"gopher\"}\n"},
+		{"xml", ContentTypeXML, &namedPayload{Name: "gopher"}, "<namedPayload><name>gopher</name></namedPayload>"},
+		{"form", ContentTypeForm, &namedPayload{Name: "gopher"}, "name=gopher"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := Encode(buf, tt.ct, tt.v); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Encode(buf, ContentTypeUnknown, M{}); err == nil {
+		t.Error("got no error for an unknown content type")
+	}
+	if err := Encode(buf, ContentTypeJSON, math.Inf(1)); err == nil {
+		t.Error("got no error for an unencodable value")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q written on error", buf.String())
+	}
+}
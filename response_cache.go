@@ -0,0 +1,232 @@
+package render
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseStore stores responses for the ResponseCache middleware, the same
+// way IdempotencyStore does for IdempotencyKey. Implementations must be safe
+// for concurrent use.
+type ResponseStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// ResponseCacheSize is the maximum number of responses kept in memory by each
+// ResponseCache middleware.
+var ResponseCacheSize = 1000
+
+// MemoryResponseStore is an in-process ResponseStore holding a bounded number
+// of responses. Expired responses are dropped on access, and the least
+// recently used ones are evicted when the store is full.
+type MemoryResponseStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // key -> *memoryEntry
+	lru     *list.List               // most recently used first
+}
+
+type memoryEntry struct {
+	key     string
+	resp    *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryResponseStore returns an empty MemoryResponseStore holding at most
+// maxEntries responses, and at least one.
+func NewMemoryResponseStore(maxEntries int) *MemoryResponseStore {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &MemoryResponseStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Get returns the response stored under key, unless expired.
+func (s *MemoryResponseStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return entry.resp, true
+}
+
+// Set stores resp under key for ttl, evicting the least recently used
+// response if the store is full.
+func (s *MemoryResponseStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &memoryEntry{key: key, resp: resp, expires: time.Now().Add(ttl)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = entry
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+// Len returns the number of responses in the store, expired or not.
+func (s *MemoryResponseStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+func (s *MemoryResponseStore) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*memoryEntry).key)
+}
+
+// ResponseCache is a middleware caching 200 OK responses to GET requests in
+// memory for ttl, keeping at most ResponseCacheSize of them, see
+// NewResponseCache.
+func ResponseCache(ttl time.Duration, keyFn func(r *http.Request) string) func(next http.Handler) http.Handler {
+	return NewResponseCache(NewMemoryResponseStore(ResponseCacheSize), ttl, keyFn)
+}
+
+// NewResponseCache returns a middleware caching 200 OK responses to GET
+// requests in store for ttl, under the key returned by keyFn, and replaying
+// them, status, headers and body, without calling the next handler until they
+// expire. A nil keyFn keys responses by request URI; an empty key skips the
+// cache.
+//
+// As the cache is shared by all clients, requests with an Authorization or
+// Cookie header bypass it, and responses setting cookies, marked private,
+// no-store or no-cache by their Cache-Control header, or varying on "*" are
+// not stored. Responses are cached per Accept header, which the responders
+// negotiate the content type from, and per value of the request headers
+// listed in their Vary header.
+func NewResponseCache(store ResponseStore, ttl time.Duration, keyFn func(r *http.Request) string) func(next http.Handler) http.Handler {
+	if keyFn == nil {
+		keyFn = func(r *http.Request) string { return r.URL.RequestURI() }
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := keyFn(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The Vary fields of the cached responses are recorded under the
+			// key itself, and the responses under the key and the values of
+			// these fields in the request.
+			if index, ok := store.Get(key); ok {
+				if resp, ok := store.Get(variantKey(key, index.Header, r)); ok {
+					resp.writeTo(w)
+					return
+				}
+			}
+
+			bw := newBufferWriter()
+			next.ServeHTTP(bw, r)
+			resp := &CachedResponse{
+				Status: bw.Status(),
+				Header: bw.Header().Clone(),
+				Body:   append([]byte(nil), bw.body.Bytes()...),
+			}
+			if resp.Status == http.StatusOK && storable(resp.Header) {
+				index := &CachedResponse{Header: http.Header{"Vary": varyFields(resp.Header)}}
+				store.Set(key, index, ttl)
+				store.Set(variantKey(key, index.Header, r), resp, ttl)
+			}
+			resp.writeTo(w)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// storable reports whether a response with the given header may be stored
+// by a cache shared by all clients.
+func storable(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 || hasVary(h, "*") {
+		return false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		for _, directive := range splitHeaderList(v) {
+			name := strings.TrimSpace(strings.SplitN(directive, "=", 2)[0])
+			switch strings.ToLower(name) {
+			case "private", "no-store", "no-cache":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// varyFields returns the request headers a response varies on: Accept and
+// the fields of its Vary header.
+func varyFields(h http.Header) []string {
+	fields := []string{"Accept"}
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = http.CanonicalHeaderKey(strings.TrimSpace(field))
+			if field != "" && !containsString(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// variantKey returns the key of the response to r among the ones stored
+// under key, as per the Vary fields recorded in index.
+func variantKey(key string, index http.Header, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, field := range index.Values("Vary") {
+		b.WriteString("\x00")
+		b.WriteString(field)
+		b.WriteString(":")
+		b.WriteString(strings.Join(r.Header.Values(field), ","))
+	}
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionedCacheKey returns a key function for ResponseCache keying responses
+// by request URI and API version, as per the given request header, e.g.
+// "Accept-Version", falling back to the given query parameter, if any, so
+// that each version is cached independently. It also adds the header to the
+// Vary header of the response.
+func VersionedCacheKey(header, param string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		version := r.Header.Get(header)
+		if version == "" && param != "" {
+			version = r.URL.Query().Get(param)
+		}
+		*r = *AddVary(r, header)
+		return r.URL.RequestURI() + "\x00" + version
+	}
+}
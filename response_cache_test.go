@@ -0,0 +1,256 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func cacheRequest(target string, header ...string) *http.Request {
+	r := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	return r
+}
+
+func TestResponseCacheHitMiss(t *testing.T) {
+	h, calls := countingHandler(http.StatusOK)
+	h = ResponseCache(time.Minute, nil)(h)
+
+	for _, tt := range []struct {
+		target    string
+		wantCalls int
+	}{
+		{"/a", 1},
+		{"/a", 1},
+		{"/a?x=1", 2},
+		{"/b", 3},
+		{"/b", 3},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, cacheRequest(tt.target))
+		if *calls != tt.wantCalls {
+			t.Errorf("%s: handler called %d times, want %d", tt.target, *calls, tt.wantCalls)
+		}
+		if want := fmt.Sprintf("{\"calls\":%d}\n", tt.wantCalls); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want 200 %q", tt.target, w.Code, w.Body.String(), want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s: got Content-Type %q", tt.target, ct)
+		}
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	h, calls := countingHandler(http.StatusOK)
+	h = ResponseCache(20*time.Millisecond, nil)(h)
+
+	h.ServeHTTP(httptest.NewRecorder(), cacheRequest("/"))
+	h.ServeHTTP(httptest.NewRecorder(), cacheRequest("/"))
+	if *calls != 1 {
+		t.Fatalf("handler called %d times before expiry, want 1", *calls)
+	}
+	time.Sleep(40 * time.Millisecond)
+	h.ServeHTTP(httptest.NewRecorder(), cacheRequest("/"))
+	if *calls != 2 {
+		t.Errorf("handler called %d times after expiry, want 2", *calls)
+	}
+}
+
+func TestResponseCacheBypass(t *testing.T) {
+	keyFn := func(r *http.Request) string {
+		if r.URL.Path == "/nocache" {
+			return ""
+		}
+		return r.URL.RequestURI()
+	}
+	tests := []struct {
+		name string
+		r    func() *http.Request
+	}{
+		{"post", func() *http.Request { return httptest.NewRequest("POST", "/", nil) }},
+		{"authorization", func() *http.Request { return cacheRequest("/", "Authorization", "Bearer x") }},
+		{"cookie", func() *http.Request { return cacheRequest("/", "Cookie", "session=x") }},
+		{"empty key", func() *http.Request { return cacheRequest("/nocache") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, calls := countingHandler(http.StatusOK)
+			h = ResponseCache(time.Minute, keyFn)(h)
+			h.ServeHTTP(httptest.NewRecorder(), tt.r())
+			h.ServeHTTP(httptest.NewRecorder(), tt.r())
+			if *calls != 2 {
+				t.Errorf("handler called %d times, want 2", *calls)
+			}
+		})
+	}
+}
+
+func TestResponseCacheNotStored(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+	}{
+		{"not found", http.StatusNotFound, nil},
+		{"created", http.StatusCreated, nil},
+		{"set cookie", http.StatusOK, http.Header{"Set-Cookie": {"session=x"}}},
+		{"private", http.StatusOK, http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{"no-store", http.StatusOK, http.Header{"Cache-Control": {"No-Store"}}},
+		{"no-cache", http.StatusOK, http.Header{"Cache-Control": {"max-age=0", "no-cache=\"Set-Cookie\""}}},
+		{"vary star", http.StatusOK, http.Header{"Vary": {"*"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryResponseStore(10)
+			calls := 0
+			h := NewResponseCache(store, time.Minute, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				RespondStatus(w, r, tt.status, M{"calls": calls})
+			}))
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, cacheRequest("/"))
+				if w.Code != tt.status {
+					t.Errorf("got status %d, want %d", w.Code, tt.status)
+				}
+			}
+			if calls != 2 {
+				t.Errorf("handler called %d times, want 2", calls)
+			}
+			if n := store.Len(); n != 0 {
+				t.Errorf("got %d stored responses, want 0", n)
+			}
+		})
+	}
+}
+
+// TestResponseCacheVariants checks that responses negotiated from the Accept
+// header, or varying on other request headers, are cached separately.
+func TestResponseCacheVariants(t *testing.T) {
+	calls := 0
+	h := ResponseCache(time.Minute, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		r = AddVary(r, "X-Tenant")
+		Respond(w, r, namedPayload{Name: r.Header.Get("X-Tenant")})
+	}))
+
+	tests := []struct {
+		accept, tenant string
+		wantType       string
+		wantCalls      int
+	}{
+		{"application/json", "a", "application/json; charset=utf-8", 1},
+		{"application/xml", "a", "application/xml; charset=utf-8", 2},
+		{"application/json", "a", "application/json; charset=utf-8", 2},
+		{"application/json", "b", "application/json; charset=utf-8", 3},
+		{"application/xml", "a", "application/xml; charset=utf-8", 3},
+		{"application/json", "b", "application/json; charset=utf-8", 3},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, cacheRequest("/", "Accept", tt.accept, "X-Tenant", tt.tenant))
+		if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+			t.Errorf("request %d: got Content-Type %q, want %q", i, ct, tt.wantType)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("request %d: handler called %d times, want %d", i, calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestResponseCacheConcurrent(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	h := ResponseCache(time.Minute, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		PlainText(w, r, r.URL.Path)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := fmt.Sprintf("/%d", i%5)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, cacheRequest(target))
+			if w.Body.String() != target {
+				t.Errorf("got %q, want %q", w.Body.String(), target)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if calls < 5 || calls > 50 {
+		t.Errorf("handler called %d times", calls)
+	}
+}
+
+func TestMemoryResponseStoreEviction(t *testing.T) {
+	store := NewMemoryResponseStore(2)
+	resp := func(s string) *CachedResponse { return &CachedResponse{Status: http.StatusOK, Body: []byte(s)} }
+
+	store.Set("a", resp("a"), time.Minute)
+	store.Set("b", resp("b"), time.Minute)
+	store.Get("a") // b is now the least recently used
+	store.Set("c", resp("c"), time.Minute)
+
+	if n := store.Len(); n != 2 {
+		t.Errorf("got %d entries, want 2", n)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := store.Get(key); ok != want {
+			t.Errorf("%s: got stored %v, want %v", key, ok, want)
+		}
+	}
+
+	store.Set("d", resp("d"), -time.Second)
+	if _, ok := store.Get("d"); ok {
+		t.Error("got an expired response")
+	}
+	if n := store.Len(); n != 1 {
+		t.Errorf("got %d entries after expiry, want 1", n)
+	}
+}
+
+func TestVersionedCacheKey(t *testing.T) {
+	h, calls := countingHandler(http.StatusOK)
+	h = NewResponseCache(NewMemoryResponseStore(10), time.Minute, VersionedCacheKey("Accept-Version", "v"))(h)
+
+	for _, tt := range []struct {
+		r         *http.Request
+		wantCalls int
+		wantBody  int // the call which produced the response
+	}{
+		{cacheRequest("/a", "Accept-Version", "1"), 1, 1},
+		{cacheRequest("/a", "Accept-Version", "2"), 2, 2},
+		{cacheRequest("/a", "Accept-Version", "1"), 2, 1},
+		{cacheRequest("/a", "Accept-Version", "2"), 2, 2},
+		{cacheRequest("/a?v=3"), 3, 3},
+		{cacheRequest("/a?v=3"), 3, 3},
+		{cacheRequest("/a"), 4, 4},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, tt.r)
+		if *calls != tt.wantCalls {
+			t.Errorf("%s %s: handler called %d times, want %d", tt.r.URL, tt.r.Header.Get("Accept-Version"), *calls, tt.wantCalls)
+		}
+		if want := fmt.Sprintf("{\"calls\":%d}\n", tt.wantBody); w.Body.String() != want {
+			t.Errorf("%s %s: got %q, want %q", tt.r.URL, tt.r.Header.Get("Accept-Version"), w.Body.String(), want)
+		}
+		if vary := w.Header().Values("Vary"); !containsString(vary, "Accept-Version") {
+			t.Errorf("got Vary %v, want Accept-Version", vary)
+		}
+	}
+}
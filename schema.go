@@ -0,0 +1,204 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONSchema returns a JSON Schema (draft-07) describing the JSON encoding of
+// v. Struct fields are named as per their `json` tags, nested struct types
+// are referenced via "$ref" from the "definitions" of the schema and pointer
+// fields are nullable. Non-pointer fields without the omitempty option are
+// required, as are fields tagged `validate:"required"`. The min, max, len,
+// oneof, email and url rules of `validate` tags are turned into constraints.
+func JSONSchema(v interface{}) ([]byte, error) {
+	g := &schemaGenerator{definitions: map[string]interface{}{}}
+	schema := g.schemaOf(reflect.TypeOf(v))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	if len(g.definitions) > 0 {
+		schema["definitions"] = g.definitions
+	}
+	return json.Marshal(schema)
+}
+
+// Schema writes the JSON Schema of v to the response, setting the
+// Content-Type as application/schema+json.
+func Schema(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := JSONSchema(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(b) //nolint:errcheck
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{} // could be anything
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Ptr:
+		return nullable(g.schemaOf(t.Elem()))
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			g.definitions[t.Name()] = map[string]interface{}{} // guards against recursive types
+			g.definitions[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	g.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, properties, required)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		schema := g.schemaOf(sf.Type)
+		rules := sf.Tag.Get("validate")
+		applyValidateRules(schema, sf.Type, rules)
+		properties[name] = schema
+
+		if hasOption(rules, "required") || (sf.Type.Kind() != reflect.Ptr && !hasOption(opts, "omitempty")) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// applyValidateRules adds the constraints of a `validate` struct tag to the
+// schema of a field of type t.
+func applyValidateRules(schema map[string]interface{}, t reflect.Type, rules string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var minKey, maxKey string
+	switch t.Kind() {
+	case reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		minKey, maxKey = "minItems", "maxItems"
+	case reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	default:
+		minKey, maxKey = "minimum", "maximum"
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		key, param := rule, ""
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			key, param = rule[:idx], rule[idx+1:]
+		}
+		switch key {
+		case "min", "gte":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				schema[minKey] = n
+			}
+		case "max", "lte":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				schema[maxKey] = n
+			}
+		case "len":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				schema[minKey] = n
+				schema[maxKey] = n
+			}
+		case "oneof":
+			schema["enum"] = strings.Fields(param)
+		case "email":
+			schema["format"] = "email"
+		case "url", "uri":
+			schema["format"] = "uri"
+		}
+	}
+}
+
+// nullable allows null in addition to the given schema.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if typ, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typ, "null"}
+		return schema
+	}
+	if len(schema) == 0 {
+		return schema // anything, including null
+	}
+	return map[string]interface{}{"oneOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+}
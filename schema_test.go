@@ -0,0 +1,131 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type (
+	schemaAddress struct {
+		City string `json:"city" validate:"required,min=1"`
+	}
+	schemaUser struct {
+		Name    string          `json:"name" validate:"max=64"`
+		Email   string          `json:"email,omitempty" validate:"required,email"`
+		Nick    string          `json:"nick,omitempty"`
+		Age     *int            `json:"age"`
+		Role    string          `json:"role" validate:"oneof=admin user"`
+		Tags    []string        `json:"tags" validate:"min=1"`
+		Address schemaAddress   `json:"address"`
+		Prev    *schemaAddress  `json:"prev"`
+		Ignored string          `json:"-"`
+		Extra   map[string]bool `json:"extra,omitempty"`
+	}
+)
+
+func decodeSchema(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	b, err := JSONSchema(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := decodeSchema(t, schemaUser{})
+	user := schema["definitions"].(map[string]interface{})["schemaUser"].(map[string]interface{})
+	props := user["properties"].(map[string]interface{})
+
+	t.Run("required", func(t *testing.T) {
+		want := []interface{}{"name", "email", "role", "tags", "address"}
+		if got := user["required"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got required %v, want %v", got, want)
+		}
+	})
+	t.Run("optional", func(t *testing.T) {
+		if _, ok := props["nick"]; !ok {
+			t.Error("missing optional nick property")
+		}
+		if _, ok := props["Ignored"]; ok {
+			t.Error(`got property for field tagged "-"`)
+		}
+	})
+	t.Run("nested ref", func(t *testing.T) {
+		if got := props["address"]; !reflect.DeepEqual(got, map[string]interface{}{"$ref": "#/definitions/schemaAddress"}) {
+			t.Errorf("got address %v", got)
+		}
+		address := schema["definitions"].(map[string]interface{})["schemaAddress"].(map[string]interface{})
+		if got := address["required"]; !reflect.DeepEqual(got, []interface{}{"city"}) {
+			t.Errorf("got address required %v", got)
+		}
+	})
+	t.Run("array", func(t *testing.T) {
+		want := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 1.0}
+		if got := props["tags"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got tags %v, want %v", got, want)
+		}
+	})
+	t.Run("nullable", func(t *testing.T) {
+		if got := props["age"]; !reflect.DeepEqual(got, map[string]interface{}{"type": []interface{}{"integer", "null"}}) {
+			t.Errorf("got age %v", got)
+		}
+		want := map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"$ref": "#/definitions/schemaAddress"},
+			map[string]interface{}{"type": "null"},
+		}}
+		if got := props["prev"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got prev %v, want %v", got, want)
+		}
+	})
+	t.Run("constraints", func(t *testing.T) {
+		want := map[string]interface{}{"type": "string", "maxLength": 64.0}
+		if got := props["name"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got name %v, want %v", got, want)
+		}
+		want = map[string]interface{}{"type": "string", "enum": []interface{}{"admin", "user"}}
+		if got := props["role"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got role %v, want %v", got, want)
+		}
+		want = map[string]interface{}{"type": "string", "format": "email"}
+		if got := props["email"]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got email %v, want %v", got, want)
+		}
+	})
+}
+
+func TestJSONSchemaRecursive(t *testing.T) {
+	type node struct {
+		Children []node
+	}
+	schema := decodeSchema(t, node{})
+	want := map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/definitions/node"}}
+	got := schema["definitions"].(map[string]interface{})["node"].(map[string]interface{})["properties"].(map[string]interface{})["Children"]
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	w := httptest.NewRecorder()
+	Schema(w, httptest.NewRequest("GET", "/schema", nil), schemaAddress{})
+	if got := w.Header().Get("Content-Type"); got != "application/schema+json" {
+		t.Errorf("got Content-Type %q, want application/schema+json", got)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if got := schema["$schema"]; got != "http://json-schema.org/draft-07/schema#" {
+		t.Errorf("got $schema %v", got)
+	}
+	if got := schema["$ref"]; got != "#/definitions/schemaAddress" {
+		t.Errorf("got $ref %v", got)
+	}
+}
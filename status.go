@@ -0,0 +1,46 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// StatusTextCtxKey is a context key to record a status text overriding the
+// default one for a single response.
+var StatusTextCtxKey = &contextKey{"StatusText"}
+
+var (
+	statusTextMu sync.RWMutex
+	statusText   = map[int]string{}
+)
+
+// SetStatusText sets a custom text for the given HTTP status code, e.g.
+// "Validation Error" for 422. Pass an empty text to restore the default.
+func SetStatusText(code int, text string) {
+	statusTextMu.Lock()
+	defer statusTextMu.Unlock()
+	if text == "" {
+		delete(statusText, code)
+		return
+	}
+	statusText[code] = text
+}
+
+// StatusText returns the text for the given HTTP status code, as set by
+// SetStatusText, falling back to http.StatusText.
+func StatusText(code int) string {
+	statusTextMu.RLock()
+	text, ok := statusText[code]
+	statusTextMu.RUnlock()
+	if ok {
+		return text
+	}
+	return http.StatusText(code)
+}
+
+// WithStatusText returns a shallow copy of r with a status text overriding
+// StatusText for its response, e.g. the ErrResponse title.
+func WithStatusText(r *http.Request, text string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), StatusTextCtxKey, text))
+}
@@ -0,0 +1,100 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStatusText(t *testing.T) {
+	defer SetStatusText(http.StatusUnprocessableEntity, "")
+	SetStatusText(http.StatusUnprocessableEntity, "Validation Error")
+
+	tests := []struct {
+		name      string
+		r         func(r *http.Request) *http.Request
+		status    int
+		wantTitle string
+	}{
+		{"custom", func(r *http.Request) *http.Request { return r }, http.StatusUnprocessableEntity, "Validation Error"},
+		{"fallback", func(r *http.Request) *http.Request { return r }, http.StatusNotFound, "Not Found"},
+		{"per response", func(r *http.Request) *http.Request { return WithStatusText(r, "No Such Gopher") }, http.StatusNotFound, "No Such Gopher"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RenderError(w, tt.r(httptest.NewRequest("GET", "/", nil)), NewErrResponse(tt.status, nil))
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			if title := decodeProblem(t, w)["title"]; title != tt.wantTitle {
+				t.Errorf("got title %v, want %q", title, tt.wantTitle)
+			}
+		})
+	}
+
+	SetStatusText(http.StatusUnprocessableEntity, "")
+	if got := StatusText(http.StatusUnprocessableEntity); got != http.StatusText(http.StatusUnprocessableEntity) {
+		t.Errorf("got %q after reset", got)
+	}
+}
+
+func TestStatusTextConcurrent(t *testing.T) {
+	defer func() {
+		for code := 600; code < 610; code++ {
+			SetStatusText(code, "")
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(code int) {
+			defer wg.Done()
+			SetStatusText(code, fmt.Sprint("Status ", code))
+		}(600 + i)
+		go func(code int) {
+			defer wg.Done()
+			StatusText(code)
+		}(600 + i)
+	}
+	wg.Wait()
+	if got := StatusText(605); got != "Status 605" {
+		t.Errorf("got %q, want Status 605", got)
+	}
+}
+
+func TestWriteHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		early bool
+		hint  int
+		want  int
+	}{
+		{"early with hint", true, http.StatusCreated, http.StatusCreated},
+		{"early without hint", true, 0, http.StatusOK},
+		{"not called", false, http.StatusCreated, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			if tt.hint != 0 {
+				Status(r, tt.hint)
+			}
+			w := httptest.NewRecorder()
+			if tt.early {
+				WriteHeader(w, r)
+			}
+			JSON(w, r, M{"a": 1})
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != `{"a":1}` {
+				t.Errorf("got %s", got)
+			}
+		})
+	}
+}
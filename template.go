@@ -0,0 +1,68 @@
+package render
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"net/http"
+	"text/template"
+)
+
+// GoTemplate executes the text template with data and writes the result to
+// the response, setting the Content-Type as text/plain. Execution errors are
+// rendered with RenderError.
+func GoTemplate(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		RenderError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType("text/plain"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset(buf.Bytes())) //nolint:errcheck
+}
+
+// GoHTMLTemplate executes the HTML template with data and writes the result
+// to the response, setting the Content-Type as text/html. Execution errors
+// are rendered with RenderError.
+func GoHTMLTemplate(w http.ResponseWriter, r *http.Request, tmpl *htmltemplate.Template, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		RenderError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType("text/html"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset(buf.Bytes())) //nolint:errcheck
+}
+
+// GoHTMLTemplateNamed is like GoHTMLTemplate, but executes the template with
+// the given name associated with tmpl, e.g. a page of a template set. An
+// unknown name is rendered with RenderError, like execution errors.
+func GoHTMLTemplateNamed(w http.ResponseWriter, r *http.Request, tmpl *htmltemplate.Template, name string, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+		RenderError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType("text/html"))
+	applyHeaders(w, r)
+	writeHeader(w, r)
+	w.Write(encodeCharset(buf.Bytes())) //nolint:errcheck
+}
+
+// TemplateEncoder encodes responses by executing a pre-parsed text template
+// with the response value as data. Use its Encode method with WithEncoder or
+// UseEncoder, e.g. render.UseEncoder(render.TemplateEncoder{tmpl}.Encode).
+type TemplateEncoder struct {
+	Template *template.Template
+}
+
+// Encode executes the template with v, see GoTemplate.
+func (e TemplateEncoder) Encode(w http.ResponseWriter, r *http.Request, v interface{}) {
+	GoTemplate(w, r, e.Template, v)
+}
@@ -0,0 +1,61 @@
+package render
+
+import (
+	htmltemplate "html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+)
+
+func TestGoTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse("Hello {{.Name}}!"))
+	pages := htmltemplate.Must(htmltemplate.New("").Parse(`{{define "index"}}<h1>{{.Name}}</h1>{{end}}{{define "broken"}}{{.Name.Missing}}{{end}}`))
+	tests := []struct {
+		name       string
+		respond    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{"text", func(w http.ResponseWriter, r *http.Request) {
+			GoTemplate(w, r, tmpl, M{"Name": "<gopher>"})
+		}, http.StatusCreated, "text/plain; charset=utf-8", "Hello <gopher>!"},
+		{"html", func(w http.ResponseWriter, r *http.Request) {
+			GoHTMLTemplate(w, r, htmltemplate.Must(htmltemplate.New("").Parse("<p>Hello {{.Name}}!</p>")), M{"Name": "<gopher>"})
+		}, http.StatusCreated, "text/html; charset=utf-8", "<p>Hello &lt;gopher&gt;!</p>"},
+		{"encoder", func(w http.ResponseWriter, r *http.Request) {
+			Respond(w, WithEncoder(r, TemplateEncoder{tmpl}.Encode), M{"Name": "gopher"})
+		}, http.StatusCreated, "text/plain; charset=utf-8", "Hello gopher!"},
+		{"html named", func(w http.ResponseWriter, r *http.Request) {
+			GoHTMLTemplateNamed(w, r, pages, "index", M{"Name": "<gopher>"})
+		}, http.StatusCreated, "text/html; charset=utf-8", "<h1>&lt;gopher&gt;</h1>"},
+		{"html named not found", func(w http.ResponseWriter, r *http.Request) {
+			GoHTMLTemplateNamed(w, r, pages, "missing", M{"Name": "gopher"})
+		}, http.StatusInternalServerError, "application/problem+json; charset=utf-8", ""},
+		{"html named error", func(w http.ResponseWriter, r *http.Request) {
+			GoHTMLTemplateNamed(w, r, pages, "broken", M{"Name": "gopher"})
+		}, http.StatusInternalServerError, "application/problem+json; charset=utf-8", ""},
+		{"error", func(w http.ResponseWriter, r *http.Request) {
+			GoTemplate(w, r, template.Must(template.New("").Parse("{{.Name.Missing}}")), M{"Name": "gopher"})
+		}, http.StatusInternalServerError, "application/problem+json; charset=utf-8", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			Status(r, http.StatusCreated)
+			tt.respond(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.wantType {
+				t.Errorf("got Content-Type %q, want %q", ct, tt.wantType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("got %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
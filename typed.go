@@ -0,0 +1,57 @@
+//go:build go1.21
+
+package render
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+)
+
+// StatusCoder is implemented by values carrying their own HTTP response
+// status code, e.g. a created resource responding with 201.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// TypedRenderer is a Renderer of a value of type T, encoded as the value
+// itself. RenderFn, if set, is called on Render; otherwise the status code of
+// values implementing StatusCoder is set as response status code hint.
+type TypedRenderer[T any] struct {
+	Value    T
+	RenderFn func(w http.ResponseWriter, r *http.Request, v T) error
+}
+
+// Of returns a TypedRenderer of v, for type-safe rendering without
+// implementing Renderer, e.g.
+//
+//	render.Render(w, r, render.Of(user))
+func Of[T any](v T) *TypedRenderer[T] {
+	return &TypedRenderer[T]{Value: v}
+}
+
+func (t *TypedRenderer[T]) Render(w http.ResponseWriter, r *http.Request) error {
+	if t.RenderFn != nil {
+		return t.RenderFn(w, r, t.Value)
+	}
+	if sc, ok := interface{}(t.Value).(StatusCoder); ok {
+		Status(r, sc.StatusCode())
+	}
+	return nil
+}
+
+func (t *TypedRenderer[T]) wrappedValue() interface{} {
+	return t.Value
+}
+
+// MarshalJSON and MarshalXML encode Value when the TypedRenderer is nested in
+// another value encoded by encoding/json or encoding/xml. DefaultResponder and
+// the JSON encoders of this package unwrap it beforehand, so that the naming
+// strategy and field filters apply.
+func (t *TypedRenderer[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Value)
+}
+
+func (t *TypedRenderer[T]) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(t.Value)
+}
@@ -0,0 +1,138 @@
+//go:build go1.21
+
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createdUser struct {
+	Name string `json:"name"`
+}
+
+func (createdUser) StatusCode() int { return http.StatusCreated }
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		v          Renderer
+		wantStatus int
+		wantBody   string
+	}{
+		{"value", Of(M{"name": "gopher"}), http.StatusOK, `{"name":"gopher"}`},
+		{"status coder", Of(createdUser{"gopher"}), http.StatusCreated, `{"name":"gopher"}`},
+		{"slice", Of([]int{1, 2}), http.StatusOK, `[1,2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := Render(w, httptest.NewRequest("GET", "/", nil), tt.v); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("got %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTypedRendererRenderFn(t *testing.T) {
+	var got createdUser
+	v := &TypedRenderer[createdUser]{
+		Value: createdUser{"gopher"},
+		RenderFn: func(w http.ResponseWriter, r *http.Request, u createdUser) error {
+			got = u
+			Status(r, http.StatusAccepted)
+			return nil
+		},
+	}
+	w := httptest.NewRecorder()
+	if err := Render(w, httptest.NewRequest("GET", "/", nil), v); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "gopher" {
+		t.Errorf("RenderFn got %+v", got)
+	}
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want RenderFn's 202 over StatusCode", w.Code)
+	}
+
+	errRender := errors.New("render failed")
+	v.RenderFn = func(w http.ResponseWriter, r *http.Request, u createdUser) error { return errRender }
+	if err := Render(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), v); err != errRender {
+		t.Errorf("got error %v, want %v", err, errRender)
+	}
+}
+
+func TestTypedRendererList(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/xml")
+	l := []Renderer{Of(namedPayload{Name: "a"}), Of(namedPayload{Name: "b"})}
+	if err := RenderList(w, r, l); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Body.String(); !strings.Contains(got, "<namedPayload><name>a</name></namedPayload><namedPayload><name>b</name></namedPayload>") {
+		t.Errorf("got %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := RenderList(w, httptest.NewRequest("GET", "/", nil), l); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `[{"name":"a"},{"name":"b"}]` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestTypedRendererEncoding(t *testing.T) {
+	defer SetJSONNamingStrategy(nil)
+
+	r := OmitFields(httptest.NewRequest("GET", "/", nil), "internal_id")
+	w := httptest.NewRecorder()
+	if err := Render(w, r, Of(secretPayload{1, "SECRET"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"UserID":1}` {
+		t.Errorf("filtered: got %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := RenderList(w, r, []Renderer{Of(secretPayload{1, "SECRET"})}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `[{"UserID":1}]` {
+		t.Errorf("filtered list: got %s", got)
+	}
+
+	SetJSONNamingStrategy(SnakeCaseNamer)
+	w = httptest.NewRecorder()
+	if err := Render(w, httptest.NewRequest("GET", "/", nil), Of(secretPayload{1, "x"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(w.Body.String()); got != `{"user_id":1,"internal_id":"x"}` {
+		t.Errorf("snake case: got %s", got)
+	}
+}
+
+func TestTypedRendererOnSuccess(t *testing.T) {
+	defer func(prev func(http.ResponseWriter, *http.Request, interface{})) { OnSuccess = prev }(OnSuccess)
+	var got interface{}
+	OnSuccess = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		got = v
+	}
+
+	if err := Render(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), Of(createdUser{"gopher"})); err != nil {
+		t.Fatal(err)
+	}
+	if got != (createdUser{"gopher"}) {
+		t.Errorf("OnSuccess got %#v, want the value", got)
+	}
+}
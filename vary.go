@@ -0,0 +1,62 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// VaryCtxKey is a context key to record the Vary header fields of a response.
+var VaryCtxKey = &contextKey{"Vary"}
+
+// AddVary returns a shallow copy of r with field added to the Vary header
+// fields of its response. Unlike setting the header directly, fields added by
+// several middlewares accumulate. The header is written by the responders.
+func AddVary(r *http.Request, field string) *http.Request {
+	fields, _ := r.Context().Value(VaryCtxKey).([]string)
+	fields = append(append([]string(nil), fields...), field)
+	return r.WithContext(context.WithValue(r.Context(), VaryCtxKey, fields))
+}
+
+// VaryMiddleware is a middleware that adds the given Vary header fields to
+// every response, see AddVary.
+func VaryMiddleware(fields ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, field := range fields {
+				r = AddVary(r, field)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// applyHeaders sets the response headers recorded in the request context,
+// right before the responders write the response header.
+func applyHeaders(w http.ResponseWriter, r *http.Request) {
+	applyVary(w, r)
+	applyLinkHeader(w, r)
+}
+
+// applyVary adds the Vary header fields recorded in the request context to
+// the response, skipping the ones already present.
+func applyVary(w http.ResponseWriter, r *http.Request) {
+	fields, _ := r.Context().Value(VaryCtxKey).([]string)
+	for _, field := range fields {
+		if !hasVary(w.Header(), field) {
+			w.Header().Add("Vary", field)
+		}
+	}
+}
+
+func hasVary(h http.Header, field string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return true
+			}
+		}
+	}
+	return false
+}
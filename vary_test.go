@@ -0,0 +1,36 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddVary(t *testing.T) {
+	addVary := func(field string) func(next http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, AddVary(r, field))
+			})
+		}
+	}
+	h := addVary("Accept-Encoding")(addVary("Accept-Language")(VaryMiddleware("Accept", "Origin")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Vary", "origin")
+			JSON(w, r, M{})
+		}))))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := []string{"origin", "Accept-Encoding", "Accept-Language", "Accept"}
+	got := w.Header().Values("Vary")
+	if len(got) != len(want) {
+		t.Fatalf("got Vary %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got Vary %q, want %q", got, want)
+			break
+		}
+	}
+}
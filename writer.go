@@ -0,0 +1,354 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// hookWriter is a http.ResponseWriter that calls beforeHeader once, right
+// before the response header gets written, so that middlewares can adjust
+// headers after the handler had a chance to set them.
+type hookWriter struct {
+	http.ResponseWriter
+	beforeHeader func(w http.ResponseWriter, status int)
+	wroteHeader  bool
+}
+
+func (w *hookWriter) WriteHeader(code int) {
+	w.flushHook(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hookWriter) Write(b []byte) (int, error) {
+	w.flushHook(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hookWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.flushHook(http.StatusOK)
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, if supported, e.g. for
+// websockets. The hook isn't called for hijacked connections.
+func (w *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := hijack(w.ResponseWriter)
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+func (w *hookWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for
+// http.ResponseController.
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flushHook calls beforeHeader, unless already done. Middlewares call it
+// after the handler returns too, as net/http writes the header implicitly
+// for handlers that don't write anything.
+func (w *hookWriter) flushHook(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.beforeHeader(w.ResponseWriter, status)
+}
+
+// hijack hijacks the connection of w, for response writers wrapping it.
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// push initiates a HTTP/2 server push through w, for response writers
+// wrapping it.
+func push(w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	if p, ok := w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ByteCountResponseWriter is a http.ResponseWriter that keeps track of the
+// number of response body bytes written, e.g. for metrics.
+type ByteCountResponseWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+// NewByteCountResponseWriter wraps w into a ByteCountResponseWriter.
+func NewByteCountResponseWriter(w http.ResponseWriter) *ByteCountResponseWriter {
+	return &ByteCountResponseWriter{ResponseWriter: w}
+}
+
+func (w *ByteCountResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(&w.bytes, int64(n))
+	return n, err
+}
+
+func (w *ByteCountResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *ByteCountResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+func (w *ByteCountResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for
+// http.ResponseController.
+func (w *ByteCountResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// BytesWritten returns the number of response body bytes written so far.
+func (w *ByteCountResponseWriter) BytesWritten() int64 {
+	return atomic.LoadInt64(&w.bytes)
+}
+
+// ResponseSizeCtxKey is a context key to record the response size.
+var ResponseSizeCtxKey = &contextKey{"ResponseSize"}
+
+// ResponseSize is a middleware that counts the response body bytes written
+// by the handler chain, which outer middlewares can read with GetResponseSize
+// once the handler has returned.
+func ResponseSize(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		size, ok := r.Context().Value(ResponseSizeCtxKey).(*int64)
+		if !ok {
+			size = new(int64)
+			*r = *r.WithContext(context.WithValue(r.Context(), ResponseSizeCtxKey, size))
+		}
+		ww := NewByteCountResponseWriter(w)
+		next.ServeHTTP(ww, r)
+		atomic.StoreInt64(size, ww.BytesWritten())
+	}
+	return http.HandlerFunc(fn)
+}
+
+// GetResponseSize returns the response size recorded by the ResponseSize
+// middleware, or 0.
+func GetResponseSize(r *http.Request) int64 {
+	if size, ok := r.Context().Value(ResponseSizeCtxKey).(*int64); ok {
+		return atomic.LoadInt64(size)
+	}
+	return 0
+}
+
+// bufferWriter is a http.ResponseWriter buffering the whole response, for
+// middlewares that need to inspect or rewrite it before it's sent.
+type bufferWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferWriter() *bufferWriter {
+	return &bufferWriter{header: http.Header{}}
+}
+
+func (w *bufferWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Status returns the buffered response status code, defaulting to 200 OK.
+func (w *bufferWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// writeTo sends the buffered response header, along with the given body, to
+// the client.
+func (w *bufferWriter) writeTo(rw http.ResponseWriter, body []byte) {
+	for k, v := range w.header {
+		rw.Header()[k] = v
+	}
+	rw.WriteHeader(w.Status())
+	rw.Write(body) //nolint:errcheck
+}
+
+// Flush flushes buffered response data to the client, returning false if w
+// doesn't support flushing.
+func Flush(w http.ResponseWriter) bool {
+	f, ok := w.(http.Flusher)
+	if ok {
+		f.Flush()
+	}
+	return ok
+}
+
+// MustFlush is like Flush, but panics if w doesn't support flushing.
+func MustFlush(w http.ResponseWriter) {
+	if !Flush(w) {
+		panic(fmt.Sprintf("render: %T doesn't support flushing", w))
+	}
+}
+
+// FlusherMiddleware is a middleware guaranteeing that the response writer
+// of the handler chain implements http.Flusher, so that streaming handlers
+// work behind response writers that don't, e.g. from other middlewares.
+// Flushing is a no-op there, as their writes aren't buffered by this package.
+func FlusherMiddleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			w = flushWriter{w}
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+type flushWriter struct {
+	http.ResponseWriter
+}
+
+func (w flushWriter) Flush() {}
+
+func (w flushWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+func (w flushWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for
+// http.ResponseController.
+func (w flushWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ErrResponseAlreadyWritten is reported by the Once middleware to OnError
+// when the handler responds more than once.
+var ErrResponseAlreadyWritten = errors.New("render: response already written")
+
+// Once is a middleware ensuring that only one response is written, e.g. when
+// a handler calls both NoContent and JSON by mistake: the first response
+// wins, a second one is dropped and reported to OnError as
+// ErrResponseAlreadyWritten, once per request. A second response starts with
+// a second response header, or with header fields set once the first
+// response header is written, as responders set them before writing, e.g.
+// the Content-Type. The body of the first response can be written in any
+// number of writes, e.g. by SendFile or streaming handlers, but trailers
+// can't be set, as that starts a second response.
+func Once(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&onceWriter{ResponseWriter: w, r: r}, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+type onceWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	status      int
+	wroteHeader bool
+	second      bool // a second response was started, dropping its writes
+	reported    bool
+}
+
+func (w *onceWriter) Header() http.Header {
+	if w.wroteHeader {
+		w.startSecond()
+		return http.Header{} // the one of the second response, dropped
+	}
+	return w.ResponseWriter.Header()
+}
+
+func (w *onceWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.startSecond()
+		return
+	}
+	// Informational responses precede the actual one.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *onceWriter) Write(b []byte) (int, error) {
+	if w.second || w.wroteHeader && !bodyAllowed(w.status) {
+		w.startSecond()
+		return len(b), nil
+	}
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *onceWriter) Flush() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.status = http.StatusOK
+	}
+	Flush(w.ResponseWriter)
+}
+
+func (w *onceWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+func (w *onceWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for
+// http.ResponseController.
+func (w *onceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *onceWriter) startSecond() {
+	w.second = true
+	if !w.reported {
+		w.reported = true
+		reportError(w.r, ErrResponseAlreadyWritten)
+	}
+}
+
+// bodyAllowed reports whether a response with the given status code can have
+// a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
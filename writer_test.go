@@ -0,0 +1,330 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// connRecorder is a httptest.ResponseRecorder supporting hijacking and
+// server push, like HTTP/1.1 and HTTP/2 response writers respectively.
+type connRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	pushed   []string
+}
+
+func newConnRecorder() *connRecorder {
+	return &connRecorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+func (w *connRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func (w *connRecorder) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestHookWriterForwarding(t *testing.T) {
+	rec := newConnRecorder()
+	h := CacheControl("no-store")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != rec {
+			t.Error("expected Unwrap to return the underlying writer")
+		}
+		if err := w.(http.Pusher).Push("/app.js", nil); err != nil {
+			t.Errorf("Push: %v", err)
+		}
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack: %v", err)
+		}
+	}))
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if !rec.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+	if len(rec.pushed) != 1 || rec.pushed[0] != "/app.js" {
+		t.Errorf("got pushes %v, want [/app.js]", rec.pushed)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("got Cache-Control %q on a hijacked connection", got)
+	}
+}
+
+func TestHookWriterNotSupported(t *testing.T) {
+	h := CacheControl("no-store")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err != http.ErrNotSupported {
+			t.Errorf("Hijack: got %v, want http.ErrNotSupported", err)
+		}
+		if err := w.(http.Pusher).Push("/app.js", nil); err != http.ErrNotSupported {
+			t.Errorf("Push: got %v, want http.ErrNotSupported", err)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestResponseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request)
+		want    int64 // -1 for any size
+	}{
+		{"json", func(w http.ResponseWriter, r *http.Request) { JSON(w, r, M{"a": 1}) }, int64(len("{\"a\":1}\n"))},
+		{"xml", func(w http.ResponseWriter, r *http.Request) {
+			XML(w, r, struct {
+				A int `xml:"a"`
+			}{1})
+		}, -1},
+		{"binary", func(w http.ResponseWriter, r *http.Request) { Data(w, r, []byte{0, 1, 2, 3}) }, 4},
+		{"empty", func(w http.ResponseWriter, r *http.Request) { NoContent(w, r) }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got int64
+			outer := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r)
+					got = GetResponseSize(r)
+				})
+			}
+			w := httptest.NewRecorder()
+			outer(ResponseSize(http.HandlerFunc(tt.respond))).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got != int64(w.Body.Len()) || tt.want >= 0 && got != tt.want {
+				t.Errorf("got %d bytes counted, %d written, want %d", got, w.Body.Len(), tt.want)
+			}
+		})
+	}
+}
+
+func TestByteCountResponseWriterForwarding(t *testing.T) {
+	rec := newConnRecorder()
+	w := NewByteCountResponseWriter(rec)
+	if w.Unwrap() != rec {
+		t.Error("expected Unwrap to return the underlying writer")
+	}
+	if err := w.Push("/app.js", nil); err != nil || len(rec.pushed) != 1 {
+		t.Errorf("Push: %v, pushed %v", err, rec.pushed)
+	}
+	if _, _, err := w.Hijack(); err != nil || !rec.hijacked {
+		t.Errorf("Hijack: %v", err)
+	}
+}
+
+// plainWriter is a http.ResponseWriter with no optional interface at all.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if !Flush(rec) {
+		t.Error("expected Flush to report success")
+	}
+	if !rec.Flushed {
+		t.Error("expected the recorder to be flushed")
+	}
+	if Flush(plainWriter{rec}) {
+		t.Error("expected Flush to report a non-flusher")
+	}
+}
+
+func TestMustFlush(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected MustFlush to panic on a non-flusher")
+		}
+	}()
+	MustFlush(plainWriter{httptest.NewRecorder()})
+}
+
+func TestFlusherMiddleware(t *testing.T) {
+	rec := newConnRecorder()
+	h := FlusherMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		MustFlush(w)
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack: %v", err)
+		}
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() == nil {
+			t.Error("expected Unwrap to return the underlying writer")
+		}
+	}))
+	h.ServeHTTP(hijackOnlyWriter{rec, rec}, httptest.NewRequest("GET", "/", nil))
+	if !rec.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+}
+
+// hijackOnlyWriter is a http.ResponseWriter that can be hijacked, but not
+// flushed.
+type hijackOnlyWriter struct {
+	http.ResponseWriter
+	rec *connRecorder
+}
+
+func (w hijackOnlyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.rec.Hijack()
+}
+
+// captureErrors sets OnError to collect the reported errors, until the
+// returned func restores it.
+func captureErrors(errs *[]error) func() {
+	prev := OnError
+	OnError = func(r *http.Request, err error) {
+		*errs = append(*errs, err)
+	}
+	return func() { OnError = prev }
+}
+
+func TestOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		respond    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantBody   string
+		wantErrs   int
+	}{
+		{"single", func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, M{"A": 1})
+		}, http.StatusOK, "{\"A\":1}\n", 0},
+		{"json twice", func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, M{"A": 1})
+			JSON(w, r, M{"B": 2})
+		}, http.StatusOK, "{\"A\":1}\n", 1},
+		{"no content then json", func(w http.ResponseWriter, r *http.Request) {
+			NoContent(w, r)
+			JSON(w, r, M{"A": 1})
+		}, http.StatusNoContent, "", 1},
+		{"json then no content", func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, M{"A": 1})
+			NoContent(w, r)
+		}, http.StatusOK, "{\"A\":1}\n", 1},
+		{"status then json", func(w http.ResponseWriter, r *http.Request) {
+			RespondStatus(w, r, http.StatusCreated, M{"A": 1})
+		}, http.StatusCreated, "{\"A\":1}\n", 0},
+		{"several writes", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("a")) //nolint:errcheck
+			w.Write([]byte("b")) //nolint:errcheck
+			Flush(w)
+			w.Write([]byte("c")) //nolint:errcheck
+		}, http.StatusOK, "abc", 0},
+		{"header then writes", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("a")) //nolint:errcheck
+			w.Write([]byte("b")) //nolint:errcheck
+		}, http.StatusAccepted, "ab", 0},
+		{"write then header fields", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("a")) //nolint:errcheck
+			w.Header().Set("X-Second", "1")
+			w.Write([]byte("b")) //nolint:errcheck
+		}, http.StatusOK, "a", 1},
+		{"three responses", func(w http.ResponseWriter, r *http.Request) {
+			JSON(w, r, M{"A": 1})
+			JSON(w, r, M{"B": 2})
+			NoContent(w, r)
+		}, http.StatusOK, "{\"A\":1}\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			defer captureErrors(&errs)()
+
+			w := httptest.NewRecorder()
+			Once(http.HandlerFunc(tt.respond)).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("got %d errors reported, want %d", len(errs), tt.wantErrs)
+			}
+			for _, err := range errs {
+				if !errors.Is(err, ErrResponseAlreadyWritten) {
+					t.Errorf("got %v, want ErrResponseAlreadyWritten", err)
+				}
+			}
+		})
+	}
+}
+
+// statusRecorder records all the status codes written.
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	w.codes = append(w.codes, code)
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestOnceSendFile(t *testing.T) {
+	var errs []error
+	defer captureErrors(&errs)()
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Once(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendFile(w, r, path)
+	})))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %d of %s bytes: %v", len(body), resp.Header.Get("Content-Length"), err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Errorf("got %d bytes, want %d", len(body), len(data))
+	}
+	if len(errs) != 0 {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestOnceInformational(t *testing.T) {
+	var errs []error
+	defer captureErrors(&errs)()
+
+	w := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	Once(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		RespondStatus(w, r, http.StatusAccepted, M{"A": 1})
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(w.codes) != 2 || w.codes[1] != http.StatusAccepted {
+		t.Errorf("got status codes %v, want [103 202]", w.codes)
+	}
+	if len(errs) != 0 {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestOnceForwarding(t *testing.T) {
+	rec := newConnRecorder()
+	Once(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := w.(http.Pusher).Push("/app.js", nil); err != nil {
+			t.Errorf("Push: %v", err)
+		}
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("Hijack: %v", err)
+		}
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !rec.hijacked || len(rec.pushed) != 1 {
+		t.Errorf("got hijacked=%v pushed=%v", rec.hijacked, rec.pushed)
+	}
+}
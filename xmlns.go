@@ -0,0 +1,100 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"sort"
+)
+
+// XMLNamespacesCtxKey is a context key to record the XML namespace prefixes
+// to declare in XML responses.
+var XMLNamespacesCtxKey = &contextKey{"XMLNamespaces"}
+
+// WithXMLNamespaces returns a shallow copy of r for which XML declares the
+// given namespaces, mapping prefixes to URIs, on the root element of the
+// response. encoding/xml doesn't handle namespace prefixes, so elements tagged
+// with prefixed names, e.g. `xml:"atom:link"`, are written as is, and rely on
+// these declarations to be valid, e.g.
+//
+//	r = render.WithXMLNamespaces(r, map[string]string{
+//		"atom": "http://www.w3.org/2005/Atom",
+//	})
+func WithXMLNamespaces(r *http.Request, nsMap map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), XMLNamespacesCtxKey, nsMap))
+}
+
+// declareXMLNamespaces adds xmlns:prefix attributes to the root element of b,
+// in prefix order, unless already declared.
+func declareXMLNamespaces(b []byte, nsMap map[string]string) []byte {
+	start, end := rootStartTag(b)
+	if start < 0 {
+		return b
+	}
+	tag := b[start:end]
+
+	prefixes := make([]string, 0, len(nsMap))
+	for prefix := range nsMap {
+		if !bytes.Contains(tag, []byte(" xmlns:"+prefix+"=")) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return b
+	}
+	sort.Strings(prefixes)
+
+	attrs := &bytes.Buffer{}
+	for _, prefix := range prefixes {
+		attrs.WriteString(" xmlns:" + prefix + `="`)
+		xml.EscapeText(attrs, []byte(nsMap[prefix])) //nolint:errcheck
+		attrs.WriteString(`"`)
+	}
+
+	insertAt := end - 1 // before '>'
+	if b[insertAt-1] == '/' {
+		insertAt-- // before "/>"
+	}
+	out := make([]byte, 0, len(b)+attrs.Len())
+	out = append(out, b[:insertAt]...)
+	out = append(out, attrs.Bytes()...)
+	return append(out, b[insertAt:]...)
+}
+
+// rootStartTag returns the bounds of the start tag of the root element of b,
+// skipping declarations, processing instructions and comments, or -1.
+func rootStartTag(b []byte) (start, end int) {
+	for i := 0; i < len(b); i++ {
+		if b[i] != '<' {
+			continue
+		}
+		if bytes.HasPrefix(b[i:], []byte("<!--")) {
+			// Comments may contain markup.
+			n := bytes.Index(b[i+4:], []byte("-->"))
+			if n < 0 {
+				break
+			}
+			i += 4 + n + 2
+			continue
+		}
+		if i+1 < len(b) && (b[i+1] == '?' || b[i+1] == '!') {
+			continue
+		}
+		var quote byte
+		for j := i + 1; j < len(b); j++ {
+			switch {
+			case quote != 0:
+				if b[j] == quote {
+					quote = 0
+				}
+			case b[j] == '"' || b[j] == '\'':
+				quote = b[j]
+			case b[j] == '>':
+				return i, j + 1
+			}
+		}
+		break
+	}
+	return -1, -1
+}
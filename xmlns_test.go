@@ -0,0 +1,66 @@
+package render
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type (
+	atomLink struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	}
+	atomFeed struct {
+		XMLName xml.Name `xml:"feed"`
+		Title   string   `xml:"title"`
+		Link    atomLink `xml:"atom:link"`
+		Entries []struct {
+			ID string `xml:"dc:identifier"`
+		} `xml:"entry"`
+	}
+)
+
+func TestWithXMLNamespaces(t *testing.T) {
+	feed := atomFeed{Title: "news", Link: atomLink{"self", "/feed?a=1&b=2"}}
+	feed.Entries = append(feed.Entries, struct {
+		ID string `xml:"dc:identifier"`
+	}{"1"})
+
+	r := WithXMLNamespaces(httptest.NewRequest("GET", "/", nil), map[string]string{
+		"dc":   "http://purl.org/dc/elements/1.1/",
+		"atom": "http://www.w3.org/2005/Atom",
+	})
+	w := httptest.NewRecorder()
+	XML(w, r, feed)
+
+	want := `<feed xmlns:atom="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<title>news</title><atom:link rel="self" href="/feed?a=1&amp;b=2"></atom:link>` +
+		`<entry><dc:identifier>1</dc:identifier></entry></feed>`
+	if got := w.Body.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDeclareXMLNamespaces(t *testing.T) {
+	nsMap := map[string]string{"a": "urn:a", "b": "urn:b&c"}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"declaration", `<?xml version="1.0"?><root><a:x/></root>`, `<?xml version="1.0"?><root xmlns:a="urn:a" xmlns:b="urn:b&amp;c"><a:x/></root>`},
+		{"comment", `<!-- <skipped> --><root/>`, `<!-- <skipped> --><root xmlns:a="urn:a" xmlns:b="urn:b&amp;c"/>`},
+		{"attributes", `<root x="1>2">`, `<root x="1>2" xmlns:a="urn:a" xmlns:b="urn:b&amp;c">`},
+		{"already declared", `<root xmlns:a="urn:other"></root>`, `<root xmlns:a="urn:other" xmlns:b="urn:b&amp;c"></root>`},
+		{"no element", `not xml`, `not xml`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(declareXMLNamespaces([]byte(tt.in), nsMap)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
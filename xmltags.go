@@ -0,0 +1,100 @@
+package render
+
+import "bytes"
+
+// XMLSelfClosingEmpty makes XML write empty elements as self-closing tags,
+// e.g. <field/> rather than the <field></field> encoding/xml produces, for
+// clients expecting the shorter form. Elements with any content, including
+// whitespace, are left alone.
+var XMLSelfClosingEmpty = false
+
+// selfCloseEmptyXML rewrites empty elements of b, e.g. <a x="1"></a>, into
+// self-closing tags, e.g. <a x="1"/>, skipping comments, CDATA sections and
+// processing instructions.
+func selfCloseEmptyXML(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		if b[i] != '<' {
+			out = append(out, b[i])
+			i++
+			continue
+		}
+
+		// Markup other than start tags is copied as is.
+		if end := skipXMLMarkup(b, i); end > i {
+			out = append(out, b[i:end]...)
+			i = end
+			continue
+		}
+
+		end := xmlTagEnd(b, i)
+		if end < 0 {
+			return append(out, b[i:]...)
+		}
+		tag := b[i:end]
+		if tag[len(tag)-2] != '/' {
+			closing := append(append([]byte("</"), xmlTagName(tag)...), '>')
+			if bytes.HasPrefix(b[end:], closing) {
+				out = append(out, tag[:len(tag)-1]...)
+				out = append(out, '/', '>')
+				i = end + len(closing)
+				continue
+			}
+		}
+		out = append(out, tag...)
+		i = end
+	}
+	return out
+}
+
+// skipXMLMarkup returns the end of the end tag, comment, CDATA section,
+// declaration or processing instruction at b[i], or i if there is none.
+func skipXMLMarkup(b []byte, i int) int {
+	rest := b[i:]
+	var terminator string
+	switch {
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		terminator = "-->"
+	case bytes.HasPrefix(rest, []byte("<![CDATA[")):
+		terminator = "]]>"
+	case bytes.HasPrefix(rest, []byte("<?")):
+		terminator = "?>"
+	case bytes.HasPrefix(rest, []byte("</")), bytes.HasPrefix(rest, []byte("<!")):
+		terminator = ">"
+	default:
+		return i
+	}
+	idx := bytes.Index(rest, []byte(terminator))
+	if idx < 0 {
+		return len(b)
+	}
+	return i + idx + len(terminator)
+}
+
+// xmlTagEnd returns the end of the start tag at b[i], skipping over quoted
+// attribute values, or -1.
+func xmlTagEnd(b []byte, i int) int {
+	var quote byte
+	for j := i + 1; j < len(b); j++ {
+		switch {
+		case quote != 0:
+			if b[j] == quote {
+				quote = 0
+			}
+		case b[j] == '"' || b[j] == '\'':
+			quote = b[j]
+		case b[j] == '>':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// xmlTagName returns the element name of a start tag.
+func xmlTagName(tag []byte) []byte {
+	name := tag[1:]
+	if idx := bytes.IndexAny(name, " \t\r\n/>"); idx >= 0 {
+		name = name[:idx]
+	}
+	return name
+}
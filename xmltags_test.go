@@ -0,0 +1,76 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelfCloseEmptyXML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", `<a></a>`, `<a/>`},
+		{"attributes", `<a x="1" y='>'></a>`, `<a x="1" y='>'/>`},
+		{"nested", `<a><b><c></c></b><d></d></a>`, `<a><b><c/></b><d/></a>`},
+		{"mixed content", `<p>text<br></br>more<i></i></p>`, `<p>text<br/>more<i/></p>`},
+		{"whitespace kept", `<a> </a>`, `<a> </a>`},
+		{"other element", `<a></b>`, `<a></b>`},
+		{"already self-closing", `<a/><b x="1"/>`, `<a/><b x="1"/>`},
+		{"namespaced", `<atom:link href="/"></atom:link>`, `<atom:link href="/"/>`},
+		{"markup", `<?xml version="1.0"?><!-- <a></a> --><r><![CDATA[<a></a>]]></r>`, `<?xml version="1.0"?><!-- <a></a> --><r><![CDATA[<a></a>]]></r>`},
+		{"unterminated", `<a><b x="1`, `<a><b x="1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(selfCloseEmptyXML([]byte(tt.in))); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestXMLSelfClosingEmpty(t *testing.T) {
+	defer func(prev bool) { XMLSelfClosingEmpty = prev }(XMLSelfClosingEmpty)
+	XMLSelfClosingEmpty = true
+
+	type item struct {
+		Name  string `xml:"name"`
+		Note  string `xml:"note"`
+		Inner struct {
+			Empty string `xml:"empty"`
+		} `xml:"inner"`
+	}
+	v := struct {
+		XMLName xml.Name `xml:"items"`
+		Items   []item   `xml:"item"`
+	}{Items: []item{{Name: "a"}, {Name: "b", Note: "c"}}}
+
+	w := httptest.NewRecorder()
+	XML(w, httptest.NewRequest("GET", "/", nil), v)
+	want := `<items><item><name>a</name><note/><inner><empty/></inner></item>` +
+		`<item><name>b</name><note>c</note><inner><empty/></inner></item></items>`
+	body := w.Body.String()
+	if !strings.HasSuffix(body, want) {
+		t.Errorf("got %s, want %s", body, want)
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(body))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid XML: %v", err)
+		}
+	}
+
+	var got struct {
+		Items []item `xml:"item"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&got); err != nil || len(got.Items) != 2 || got.Items[1].Note != "c" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}